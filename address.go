@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/ardnew/appium-agent/netif"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// listenAddress returns the IP address of the Appium REST server
+// selected by listen-network (and listen-ipv6).
+func (a *agent) listenAddress() (string, error) {
+	v, ok := a.cfg.Env.Lookup("listen_name")
+	if !ok {
+		return "", fmt.Errorf("%w: %q", status.ErrIdentUndef, "listen_name")
+	}
+	ipv6 := false
+	if b, ok := a.cfg.Env.Lookup("listen_ipv6"); ok && b.String() != "" {
+		var err error
+		if ipv6, err = strconv.ParseBool(b.String()); err != nil {
+			return "", fmt.Errorf("%w: listen_ipv6=%q: %w", status.ErrInvalidValue, b.String(), err)
+		}
+	}
+	ifs, err := netif.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	ip, err := netif.Resolve(ifs, v.String(), ipv6)
+	if err != nil {
+		return "", fmt.Errorf("listen-network: %w", err)
+	}
+	return ip.String(), nil
+}
+
+// runAddress prints the IP address of the Appium REST server.
+func runAddress(a *agent, _ []string) error {
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+	addr, err := a.listenAddress()
+	if err != nil {
+		return err
+	}
+	fmt.Println(addr)
+	return nil
+}
@@ -0,0 +1,40 @@
+package appium
+
+import "time"
+
+const (
+	ServiceURLIdent = "service_url"
+	AppIDIdent      = "app_id"
+)
+
+const (
+	AutomationName   = "XCUITest"
+	KeychainPath     = "/Users/fsds/Library/Keychains/login.keychain-db"
+	KeychainPassword = "fsdspass"
+)
+
+const (
+	// ScreenshotQuality ranges from 0 (highest) to 2 (lowest).
+	ScreenshotQuality = 2
+)
+
+const (
+	// UDIDPrefix identifies a target device given by hardware UDID
+	// instead of by its common name.
+	UDIDPrefix = "id="
+
+	// CapabilityPrefix is the vendor prefix of Appium capabilities, which is
+	// implied for those in "appium:options".
+	CapabilityPrefix = "appium:"
+)
+
+// The JSON key of the server arguments object in config.json.
+const ServerKey = "server"
+
+// The JSON path of the capabilities object in config.json.
+var OptionsPath = []string{ //nolint:gochecknoglobals
+	ServerKey, "default-capabilities", "appium:options",
+}
+
+// ReadyInterval is the delay between requests to Appium's /status endpoint.
+const ReadyInterval = 250 * time.Millisecond
@@ -0,0 +1,116 @@
+package appium
+
+// Standalone functions (non-methods) supporting type Options.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Merge applies the JSON merge patch (RFC 7386) to doc and returns the result.
+//
+// Objects are merged recursively, null values in patch remove the
+// corresponding member of doc, and all other values replace it.
+func Merge(doc, patch map[string]any) map[string]any {
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	for key, val := range patch {
+		switch pv := val.(type) {
+		case nil:
+			delete(doc, key)
+		case map[string]any:
+			dv, _ := doc[key].(map[string]any)
+			doc[key] = Merge(dv, pv)
+		default:
+			doc[key] = val
+		}
+	}
+	return doc
+}
+
+// ReadFile returns the JSON object decoded from the file at path.
+// A file that does not exist is treated as an empty object.
+func ReadFile(path string) (map[string]any, error) {
+	doc := map[string]any{}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return doc, nil
+		}
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrReadFile, path, err)
+	}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrInvalidJSON, path, err)
+	}
+	return doc, nil
+}
+
+// WriteFile atomically replaces the file at path with the given JSON object,
+// while holding the advisory lock on the lock file at lock (see
+// command.AppiumdConfigLock).
+func WriteFile(path, lock string, doc map[string]any) error {
+	return config.WriteLockedFile(lock, path, 0o644, func(w io.Writer) error { //nolint:gomnd,mnd
+		return Encode(w, doc)
+	})
+}
+
+// Encode writes the given JSON object to w using the same indentation as
+// the stock config.json.
+func Encode(w io.Writer, doc map[string]any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("%w: %w", status.ErrInvalidJSON, err)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Generate merges the capabilities defined by the given configuration
+// into the config.json file at path, while holding the advisory lock on the
+// lock file at lock (see WriteFile).
+//
+// The file is not modified if the result does not conform to the schema.
+func Generate(path, lock string, m *config.Model, schema *Schema) error {
+	opt, err := NewOptions(m)
+	if err != nil {
+		return err
+	}
+	patch, err := opt.Patch()
+	if err != nil {
+		return err
+	}
+	srv, err := NewServer(m)
+	if err != nil {
+		return err
+	}
+	doc, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+	doc = Merge(Merge(doc, patch), srv.Patch())
+	if err = schema.Check(normalize(doc)); err != nil {
+		return err
+	}
+	return WriteFile(path, lock, doc)
+}
+
+// normalize returns doc as it would be decoded from its JSON encoding,
+// so that Go types (e.g., int) are validated as their JSON counterparts.
+func normalize(doc map[string]any) any {
+	var out any
+	if b, err := json.Marshal(doc); err == nil {
+		_ = json.Unmarshal(b, &out)
+	}
+	return out
+}
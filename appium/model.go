@@ -0,0 +1,243 @@
+package appium
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Options are the XCUITest driver capabilities written to
+// "appium:options" of the default capabilities in config.json.
+//
+// Fields with the omitempty tag are optional and are removed from config.json
+// when undefined (see Patch).
+type Options struct {
+	// Required capabilities
+	AutomationName  string `json:"automationName"`
+	PlatformVersion string `json:"platformVersion"`
+
+	UseNewWDA bool `json:"useNewWDA"`
+
+	// Appium/WebDriverAgent optimizations
+	ShouldUseSingletonTestManager bool `json:"shouldUseSingletonTestManager"`
+	WaitForQuiescence             bool `json:"waitForQuiescence"`
+	ScreenshotQuality             int  `json:"screenshotQuality"`
+
+	// The following is required when auto-provisioning is enabled to allow
+	// automatic renewal of expired profiles (and certificates).
+	AllowProvisioningUpdates            bool `json:"allowProvisioningUpdates"`
+	AllowProvisioningDeviceRegistration bool `json:"allowProvisioningDeviceRegistration"`
+
+	ShowXcodeLog bool `json:"showXcodeLog"`
+	ShowIOSLog   bool `json:"showIOSLog"`
+
+	// Access to keychain is required for use with code signing assets
+	KeychainPath     string `json:"keychainPath"`
+	KeychainPassword string `json:"keychainPassword"`
+
+	// Prebuilt WebDriverAgent service
+	WebDriverAgentURL  string `json:"webDriverAgentUrl,omitempty"`
+	UpdatedWDABundleID string `json:"updatedWDABundleId,omitempty"`
+	WDALocalPort       int    `json:"wdaLocalPort,omitempty"`
+	UsePrebuiltWDA     bool   `json:"usePrebuiltWDA,omitempty"`
+
+	// Device under test, either by hardware UDID or by common name
+	UDID       string `json:"udid,omitempty"`
+	DeviceName string `json:"deviceName,omitempty"`
+
+	// App under test
+	BundleID           string `json:"bundleId"`
+	NoReset            bool   `json:"noReset"`
+	AutoLaunch         bool   `json:"autoLaunch"` // launch app under test (not test driver)
+	ShouldTerminateApp bool   `json:"shouldTerminateApp"`
+	ForceAppLaunch     bool   `json:"forceAppLaunch"`
+
+	// Additional capabilities from the capabilities parameter (and --cap),
+	// which override any of the above.
+	Extra map[string]any `json:"-"`
+}
+
+// optional lists the JSON keys of Options that are removed when undefined.
+var optional = []string{ //nolint:gochecknoglobals
+	"webDriverAgentUrl", "updatedWDABundleId", "wdaLocalPort", "usePrebuiltWDA",
+	"udid", "deviceName",
+}
+
+// NewOptions returns the capabilities defined by the given configuration.
+//
+// The environment variables service_url (captured from the WebDriverAgent log)
+// and app_id (overrides bundled_app) are also consulted, if defined.
+// Command substitutions are run only if they are allowed (see config.Model.Expand).
+func NewOptions(m *config.Model) (*Options, error) {
+	var err error
+	val := map[string]string{}
+	for _, ident := range []string{
+		"sdk_version", "target_dest", "bundled_app", "bundled_drv",
+		"driver_port", "trace_agent",
+	} {
+		if val[ident], err = m.Expand(ident); err != nil {
+			return nil, err
+		}
+	}
+	if id, ok := os.LookupEnv(AppIDIdent); ok && id != "" {
+		val["bundled_app"] = id
+	}
+
+	opt := &Options{
+		AutomationName:                      AutomationName,
+		PlatformVersion:                     val["sdk_version"],
+		UseNewWDA:                           true,
+		ShouldUseSingletonTestManager:       false,
+		WaitForQuiescence:                   false,
+		ScreenshotQuality:                   ScreenshotQuality,
+		AllowProvisioningUpdates:            true,
+		AllowProvisioningDeviceRegistration: true,
+		ShowXcodeLog:                        true,
+		KeychainPath:                        KeychainPath,
+		KeychainPassword:                    KeychainPassword,
+		BundleID:                            val["bundled_app"],
+		NoReset:                             true,
+		AutoLaunch:                          true,
+		ShouldTerminateApp:                  true,
+		ForceAppLaunch:                      true,
+	}
+	if s := val["trace_agent"]; s != "" {
+		if opt.ShowIOSLog, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("%w: %s=%q: %w", status.ErrInvalidValue, "trace_agent", s, err)
+		}
+	}
+
+	// Use the prebuilt WebDriverAgent if any of its parameters are defined.
+	opt.WebDriverAgentURL = os.Getenv(ServiceURLIdent)
+	opt.UpdatedWDABundleID = val["bundled_drv"]
+	if s := val["driver_port"]; s != "" {
+		if opt.WDALocalPort, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("%w: %s=%q: %w", status.ErrInvalidValue, "driver_port", s, err)
+		}
+	}
+	opt.UsePrebuiltWDA = opt.WebDriverAgentURL != "" ||
+		opt.UpdatedWDABundleID != "" || opt.WDALocalPort != 0
+
+	if v, ok := m.Env.Lookup("appium_caps"); ok {
+		if s := strings.TrimSpace(v.String()); s != "" {
+			if err = json.Unmarshal([]byte(s), &opt.Extra); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", status.ErrInvalidJSON, "appium_caps", err)
+			}
+		}
+	}
+
+	// If target_dest begins with "id=", then interpret it as a hardware UDID.
+	// Otherwise, the device is specified by the more user-friendly common name.
+	if udid, ok := strings.CutPrefix(val["target_dest"], UDIDPrefix); ok {
+		opt.UDID = udid
+	} else {
+		opt.DeviceName = val["target_dest"]
+	}
+	return opt, nil
+}
+
+// Patch returns the options as a JSON merge patch (RFC 7386) of config.json.
+//
+// Undefined optional capabilities are mapped to null so that Merge removes
+// any stale value, e.g., "udid" after switching to a device name.
+func (o *Options) Patch() (map[string]any, error) {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", status.ErrInvalidValue, err)
+	}
+	opt := map[string]any{}
+	if err = json.Unmarshal(b, &opt); err != nil {
+		return nil, fmt.Errorf("%w: %w", status.ErrInvalidValue, err)
+	}
+	for _, key := range optional {
+		if _, ok := opt[key]; !ok {
+			opt[key] = nil
+		}
+	}
+	for _, key := range sortedKeys(o.Extra) {
+		val := o.Extra[key]
+		name := strings.TrimPrefix(key, CapabilityPrefix)
+		if old, ok := opt[name]; ok && old != nil && !reflect.DeepEqual(old, val) {
+			fmt.Fprintf(os.Stderr, "warning: capability %q overrides built-in value %s with %s\n",
+				name, encodeValue(old), encodeValue(val))
+		}
+		opt[name] = val
+	}
+	patch := opt
+	for i := len(OptionsPath) - 1; i >= 0; i-- {
+		patch = map[string]any{OptionsPath[i]: patch}
+	}
+	return patch, nil
+}
+
+// Server are the list-valued server arguments written to "server" in
+// config.json, each defined by an aggregate configuration parameter.
+//
+// A nil list was not defined by the user (it is only a default), and leaves
+// config.json unchanged; a non-nil empty list removes the argument.
+type Server struct {
+	UseDrivers    []string `json:"use-drivers"`
+	UsePlugins    []string `json:"use-plugins"`
+	AllowInsecure []string `json:"allow-insecure"`
+}
+
+// NewServer returns the server arguments defined by the given configuration.
+func NewServer(m *config.Model) (*Server, error) {
+	list := func(ident string) ([]string, error) {
+		v, ok := m.Env.Lookup(ident)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", status.ErrIdentUndef, ident)
+		}
+		if !v.UserDef && v.Source == config.SourceDefault {
+			return nil, nil
+		}
+		return append([]string{}, v.List()...), nil
+	}
+	var (
+		srv Server
+		err error
+	)
+	if srv.UseDrivers, err = list("use_drivers"); err != nil {
+		return nil, err
+	}
+	if srv.UsePlugins, err = list("use_plugins"); err != nil {
+		return nil, err
+	}
+	if srv.AllowInsecure, err = list("allow_insecure"); err != nil {
+		return nil, err
+	}
+	return &srv, nil
+}
+
+// Patch returns the server arguments as a JSON merge patch (RFC 7386) of
+// config.json. Nil lists are omitted, so that config.json keeps its values.
+// Empty lists are mapped to null so that Merge removes them, restoring
+// Appium's defaults.
+func (s *Server) Patch() map[string]any {
+	srv := map[string]any{}
+	for key, l := range map[string][]string{
+		"use-drivers":    s.UseDrivers,
+		"use-plugins":    s.UsePlugins,
+		"allow-insecure": s.AllowInsecure,
+	} {
+		switch {
+		case l == nil:
+			continue
+		case len(l) == 0:
+			srv[key] = nil
+			continue
+		}
+		items := make([]any, len(l))
+		for i, item := range l {
+			items[i] = item
+		}
+		srv[key] = items
+	}
+	return map[string]any{ServerKey: srv}
+}
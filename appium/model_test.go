@@ -0,0 +1,249 @@
+package appium
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// stockConfig is the config.json shipped with the installation prefix.
+var stockConfig = filepath.Join("..", "run", "etc", "appium", "config.json") //nolint:gochecknoglobals
+
+func defaultModel(t *testing.T) *config.Model {
+	t.Helper()
+	m := new(config.Model)
+	if err := m.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func readStock(t *testing.T) map[string]any {
+	t.Helper()
+	return readFile(t, stockConfig)
+}
+
+func readFile(t *testing.T, path string) map[string]any {
+	t.Helper()
+	doc, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestServerPatchDefaultKeepsConfig(t *testing.T) {
+	srv, err := NewServer(defaultModel(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Merge(readStock(t), srv.Patch()), readStock(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("default server changed config.json:\ngot  %v\nwant %v", got[ServerKey], want[ServerKey])
+	}
+}
+
+func TestServerPatchUserDefined(t *testing.T) {
+	tests := []struct {
+		name  string
+		ident string
+		value string
+		key   string
+		want  any // nil if the key is removed
+	}{
+		{"replace", "use_drivers", "xcuitest,espresso", "use-drivers", []any{"xcuitest", "espresso"}},
+		{"clear", "use_plugins", "", "use-plugins", nil},
+		{"add", "allow_insecure", "session_discovery", "allow-insecure", []any{"session_discovery"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := defaultModel(t)
+			v, ok := m.Env.Lookup(tt.ident)
+			if !ok {
+				t.Fatalf("undefined %q", tt.ident)
+			}
+			if err := v.Set(tt.value); err != nil {
+				t.Fatal(err)
+			}
+			v.UserDef = true
+			srv, err := NewServer(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc := Merge(readStock(t), srv.Patch())
+			got, ok := doc[ServerKey].(map[string]any)[tt.key]
+			if tt.want == nil {
+				if ok {
+					t.Errorf("%s = %v, want removed", tt.key, got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.key, got, tt.want)
+			}
+			// The other lists are unchanged.
+			stock := readStock(t)[ServerKey].(map[string]any)
+			for key, val := range stock {
+				if key != tt.key && !reflect.DeepEqual(doc[ServerKey].(map[string]any)[key], val) {
+					t.Errorf("%s changed", key)
+				}
+			}
+		})
+	}
+}
+
+func TestOptionsPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string            // config.env fixture in testdata
+		set  map[string]string // process environment
+		want string            // expected patch in testdata
+	}{
+		{"device name", "device-name.env", nil, "device-name.json"},
+		{"prebuilt WebDriverAgent", "prebuilt-wda.env", nil, "prebuilt-wda.json"},
+		{
+			"service URL and app ID", "device-name.env",
+			map[string]string{ServiceURLIdent: "http://192.168.1.10:8100", AppIDIdent: "com.example.other"},
+			"device-name-service.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, ident := range []string{ServiceURLIdent, AppIDIdent} {
+				t.Setenv(ident, tt.set[ident])
+			}
+			m := defaultModel(t)
+			if err := m.Env.LoadFile(filepath.Join("testdata", tt.env), config.SourceFile); err != nil {
+				t.Fatal(err)
+			}
+			opt, err := NewOptions(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patch, err := opt.Patch()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compare the JSON encodings, as written to config.json.
+			got, err := json.Marshal(patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := ReadFile(filepath.Join("testdata", tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotDoc map[string]any
+			if err = json.Unmarshal(got, &gotDoc); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotDoc, want) {
+				t.Errorf("capabilities of %s:\ngot  %s\nwant %v", tt.env, got, want)
+			}
+		})
+	}
+}
+
+func TestGenerateCommandSubst(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("allow-exec=%v", allow), func(t *testing.T) {
+			dir := t.TempDir()
+			marker := filepath.Join(dir, "executed")
+			path := filepath.Join(dir, "config.json")
+			stock, err := os.ReadFile(stockConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(path, stock, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			m := defaultModel(t)
+			m.AllowExec = allow
+			sdk, _ := m.Env.Lookup("sdk_version")
+			if err = sdk.Set("17.4"); err != nil { // the default runs xcrun(1)
+				t.Fatal(err)
+			}
+			app, _ := m.Env.Lookup("bundled_app")
+			if err = app.Set("$( touch " + marker + " && echo com.example.subst )"); err != nil {
+				t.Fatal(err)
+			}
+			app.UserDef = true
+			app.Define(config.SourceFlag, "--"+app.Flag)
+			sch, err := DefaultSchema()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Generate(path, filepath.Join(t.TempDir(), "run", "config.json.lock"), m, sch)
+			_, serr := os.Stat(marker)
+			if !allow {
+				if !errors.Is(err, status.ErrExecDenied) {
+					t.Errorf("Generate() = %v, want %v", err, status.ErrExecDenied)
+				}
+				if serr == nil {
+					t.Error("denied command substitution was executed")
+				}
+				if got, _ := os.ReadFile(path); !bytes.Equal(got, stock) {
+					t.Error("config.json changed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if serr != nil {
+				t.Error("allowed command substitution was not executed")
+			}
+			doc := readFile(t, path)
+			var opt any = doc
+			for _, key := range OptionsPath {
+				opt = opt.(map[string]any)[key]
+			}
+			if id := opt.(map[string]any)["bundleId"]; id != "com.example.subst" {
+				t.Errorf("bundleId = %v, want %q", id, "com.example.subst")
+			}
+		})
+	}
+}
+
+// TestGenerateLock checks that the lock guarding config.json is held in the
+// given lock file, and that no lock file is left next to config.json.
+func TestGenerateLock(t *testing.T) {
+	etc, run := filepath.Join(t.TempDir(), "etc"), filepath.Join(t.TempDir(), "run")
+	path, lock := filepath.Join(etc, "config.json"), filepath.Join(run, "config.json.lock")
+	m := defaultModel(t)
+	if sdk, _ := m.Env.Lookup("sdk_version"); sdk.Set("17.4") != nil { // the default runs xcrun(1)
+		t.Fatal("cannot set sdk_version")
+	}
+	sch, err := DefaultSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	held, err := config.AcquireLockFile(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Generate(path, lock, m, sch); !errors.Is(err, status.ErrLocked) {
+		t.Errorf("Generate() while locked = %v, want %v", err, status.ErrLocked)
+	}
+	held.Release()
+	if err = Generate(path, lock, m, sch); err != nil {
+		t.Fatal(err)
+	}
+	ent, err := os.ReadDir(etc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ent) != 1 || ent[0].Name() != "config.json" {
+		t.Errorf("files next to config.json = %v, want only config.json", ent)
+	}
+	if _, err = os.Stat(lock); err != nil {
+		t.Errorf("lock file: %v", err)
+	}
+}
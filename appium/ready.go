@@ -0,0 +1,117 @@
+package appium
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// StatusURL returns the URL of the /status endpoint of the Appium server
+// listening on addr and port. Unspecified addresses (e.g., "0.0.0.0") are
+// replaced with the loopback address.
+func StatusURL(addr string, port int) string {
+	if ip := net.ParseIP(addr); ip != nil && ip.IsUnspecified() {
+		addr = "127.0.0.1"
+		if ip.To4() == nil {
+			addr = "::1"
+		}
+	}
+	return "http://" + net.JoinHostPort(addr, strconv.Itoa(port)) + "/status"
+}
+
+// Ready reports whether the Appium server at url (see StatusURL) is ready to
+// accept new sessions.
+//
+// Appium responds with {"value":{"ready":true, …}}; a successful response
+// without a "ready" member is also considered ready.
+func Ready(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", status.ErrNotReady, err)
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", status.ErrNotReady, err)
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s: %s", status.ErrNotReady, url, rsp.Status)
+	}
+	var body struct {
+		Value struct {
+			Ready   *bool  `json:"ready"`
+			Message string `json:"message"`
+		} `json:"value"`
+	}
+	if err = json.NewDecoder(rsp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("%w: %s: %w", status.ErrInvalidJSON, url, err)
+	}
+	if body.Value.Ready != nil && !*body.Value.Ready {
+		return fmt.Errorf("%w: %s: %s", status.ErrNotReady, url, body.Value.Message)
+	}
+	return nil
+}
+
+// WaitReady polls the Appium server at url until it is ready or timeout
+// elapses, returning the last error observed in the latter case.
+func WaitReady(ctx context.Context, url string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	client := &http.Client{Timeout: ReadyInterval * 4} //nolint:gomnd,mnd
+	tick := time.NewTicker(ReadyInterval)
+	defer tick.Stop()
+	var last error
+	for {
+		err := Ready(ctx, client, url)
+		if err == nil {
+			return nil
+		}
+		// Prefer the cause reported before the deadline interrupted a request.
+		if last == nil || ctx.Err() == nil {
+			last = err
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out after %v: %w", timeout, last)
+		case <-tick.C:
+		}
+	}
+}
+
+// Identify returns a description of the WebDriver server (Appium or
+// WebDriverAgent) responding at url (see StatusURL), if any.
+func Identify(ctx context.Context, client *http.Client, url string) (string, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", false
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return "", false
+	}
+	defer rsp.Body.Close()
+	var body struct {
+		Value struct {
+			Build struct {
+				Version  string `json:"version"`
+				BundleID string `json:"productBundleIdentifier"`
+			} `json:"build"`
+		} `json:"value"`
+	}
+	if json.NewDecoder(rsp.Body).Decode(&body) != nil {
+		return "an HTTP server", true
+	}
+	switch build := body.Value.Build; {
+	case build.BundleID != "":
+		return "WebDriverAgent (" + build.BundleID + ")", true
+	case build.Version != "":
+		return "Appium " + build.Version, true
+	}
+	return "an HTTP server", true
+}
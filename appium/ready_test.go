@@ -0,0 +1,143 @@
+package appium
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// statusServer returns a stand-in Appium server whose /status endpoint
+// responds to the n-th request (counting from 0) with respond(n).
+func statusServer(t *testing.T, respond func(n int32) (int, string)) string {
+	t.Helper()
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		code, body := respond(count.Add(1) - 1)
+		w.WriteHeader(code)
+		_, _ = io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/status"
+}
+
+func TestWaitReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(n int32) (int, string)
+		timeout time.Duration
+		want    error // nil if ready
+	}{
+		{
+			name: "ready",
+			respond: func(int32) (int, string) {
+				return http.StatusOK, `{"value":{"ready":true,"message":"The server is ready to accept new connections"}}`
+			},
+			timeout: time.Second,
+		},
+		{
+			name: "ready without member",
+			respond: func(int32) (int, string) {
+				return http.StatusOK, `{"value":{"build":{"version":"2.11.0"}}}`
+			},
+			timeout: time.Second,
+		},
+		{
+			name: "not ready then ready",
+			respond: func(n int32) (int, string) {
+				switch n {
+				case 0:
+					return http.StatusServiceUnavailable, ""
+				case 1:
+					return http.StatusOK, `{"value":{"ready":false,"message":"starting"}}`
+				}
+				return http.StatusOK, `{"value":{"ready":true}}`
+			},
+			timeout: 5 * time.Second,
+		},
+		{
+			name: "invalid JSON",
+			respond: func(int32) (int, string) {
+				return http.StatusOK, `<html>not appium</html>`
+			},
+			timeout: 2 * ReadyInterval,
+			want:    status.ErrInvalidJSON,
+		},
+		{
+			name: "timeout",
+			respond: func(int32) (int, string) {
+				return http.StatusOK, `{"value":{"ready":false,"message":"starting"}}`
+			},
+			timeout: 2 * ReadyInterval,
+			want:    status.ErrNotReady,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WaitReady(context.Background(), statusServer(t, tt.respond), tt.timeout)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("WaitReady() = %v, want ready", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("WaitReady() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaitReadyUnreachable(t *testing.T) {
+	// Close the server so that every request is refused.
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL + "/status"
+	srv.Close()
+	start := time.Now()
+	err := WaitReady(context.Background(), url, 2*ReadyInterval)
+	if !errors.Is(err, status.ErrNotReady) {
+		t.Errorf("WaitReady() = %v, want %v", err, status.ErrNotReady)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("WaitReady() returned after %v, want about %v", elapsed, 2*ReadyInterval)
+	}
+}
+
+func TestWaitReadyCanceled(t *testing.T) {
+	url := statusServer(t, func(int32) (int, string) {
+		return http.StatusOK, `{"value":{"ready":false}}`
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WaitReady(ctx, url, time.Minute); !errors.Is(err, status.ErrNotReady) {
+		t.Errorf("WaitReady() = %v, want %v", err, status.ErrNotReady)
+	}
+}
+
+func TestStatusURL(t *testing.T) {
+	tests := []struct {
+		addr string
+		port int
+		want string
+	}{
+		{"0.0.0.0", 4723, "http://127.0.0.1:4723/status"},
+		{"::", 4723, "http://[::1]:4723/status"},
+		{"192.168.1.10", 4724, "http://192.168.1.10:4724/status"},
+		{"localhost", 4723, "http://localhost:4723/status"},
+	}
+	for _, tt := range tests {
+		if got := StatusURL(tt.addr, tt.port); got != tt.want {
+			t.Errorf("StatusURL(%q, %d) = %q, want %q", tt.addr, tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package appium
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// schemaJSON is a pinned copy of the JSON schema for Appium's config.json,
+// so that validation does not depend on the installed Appium.
+//
+//go:embed schema.json
+var schemaJSON []byte
+
+// Schema validates JSON documents against a JSON schema.
+//
+// It implements the validation vocabulary used by Appium's schema (draft-07),
+// along with the applicator keywords shared with later drafts (2019-09 and
+// 2020-12). Annotations such as "format" and "default" are not asserted.
+// References ("$ref") must be JSON pointers into the same schema.
+type Schema struct {
+	root any
+}
+
+// Violation describes a value that does not conform to the schema.
+type Violation struct {
+	Path    string // JSON pointer to the offending value
+	Message string
+}
+
+func (v Violation) Error() string { return v.Path + ": " + v.Message }
+
+// DefaultSchema returns the schema bundled with the agent.
+func DefaultSchema() (*Schema, error) {
+	return ParseSchema(schemaJSON)
+}
+
+// LoadSchema returns the schema read from the file at path.
+func LoadSchema(path string) (*Schema, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrReadFile, path, err)
+	}
+	return ParseSchema(b)
+}
+
+// ParseSchema returns the schema decoded from b.
+func ParseSchema(b []byte) (*Schema, error) {
+	var root any
+	if err := json.Unmarshal(b, &root); err != nil {
+		return nil, fmt.Errorf("%w: schema: %w", status.ErrInvalidJSON, err)
+	}
+	return &Schema{root: root}, nil
+}
+
+// Check returns an error wrapping every violation found in doc,
+// or nil if doc conforms to the schema.
+func (s *Schema) Check(doc any) error {
+	vs := s.Validate(doc)
+	if len(vs) == 0 {
+		return nil
+	}
+	errs := make([]error, 0, len(vs)+1)
+	errs = append(errs, status.ErrSchemaViolation)
+	for _, v := range vs {
+		errs = append(errs, v)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate returns all violations found in doc, ordered by path.
+func (s *Schema) Validate(doc any) []Violation {
+	var out []Violation
+	s.validate(s.root, doc, "", &out)
+	slices.SortStableFunc(out, func(a, b Violation) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return out
+}
+
+func (s *Schema) validate(node, val any, path string, out *[]Violation) {
+	report := func(format string, arg ...any) {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		*out = append(*out, Violation{Path: p, Message: fmt.Sprintf(format, arg...)})
+	}
+
+	switch sch := node.(type) {
+	case bool:
+		if !sch {
+			report("value not allowed")
+		}
+		return
+	case map[string]any:
+		s.validateObject(sch, val, path, out, report)
+	}
+}
+
+//nolint:gocognit,gocyclo,cyclop,funlen,maintidx
+func (s *Schema) validateObject(
+	sch map[string]any, val any, path string, out *[]Violation,
+	report func(string, ...any),
+) {
+	if ref, ok := sch["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err != nil {
+			report("%v", err)
+		} else {
+			s.validate(target, val, path, out)
+		}
+	}
+
+	if t, ok := sch["type"]; ok {
+		want := typeNames(t)
+		if !slices.ContainsFunc(want, func(name string) bool { return isType(val, name) }) {
+			report("expected %s, got %s", strings.Join(want, " or "), typeOf(val))
+			return // further assertions would only repeat the type mismatch
+		}
+	}
+	if e, ok := sch["enum"].([]any); ok {
+		if !slices.ContainsFunc(e, func(x any) bool { return reflect.DeepEqual(x, val) }) {
+			report("value %s is not one of %s", encodeValue(val), encodeValue(e))
+		}
+	}
+	if c, ok := sch["const"]; ok && !reflect.DeepEqual(c, val) {
+		report("value %s is not %s", encodeValue(val), encodeValue(c))
+	}
+
+	for _, sub := range schemaList(sch["allOf"]) {
+		s.validate(sub, val, path, out)
+	}
+	if subs := schemaList(sch["anyOf"]); len(subs) > 0 {
+		if s.count(subs, val, path) == 0 {
+			report("value does not match any allowed schema (anyOf)")
+		}
+	}
+	if subs := schemaList(sch["oneOf"]); len(subs) > 0 {
+		if n := s.count(subs, val, path); n != 1 {
+			report("value matches %d schemas, expected exactly 1 (oneOf)", n)
+		}
+	}
+	if not, ok := sch["not"]; ok && s.count([]any{not}, val, path) > 0 {
+		report("value matches a disallowed schema (not)")
+	}
+	if cond, ok := sch["if"]; ok {
+		if s.count([]any{cond}, val, path) > 0 {
+			if then, ok := sch["then"]; ok {
+				s.validate(then, val, path, out)
+			}
+		} else if els, ok := sch["else"]; ok {
+			s.validate(els, val, path, out)
+		}
+	}
+
+	switch v := val.(type) {
+	case map[string]any:
+		props, _ := sch["properties"].(map[string]any)
+		patterns, _ := sch["patternProperties"].(map[string]any)
+		for _, req := range schemaList(sch["required"]) {
+			if name, ok := req.(string); ok {
+				if _, ok := v[name]; !ok {
+					report("missing required property %q", name)
+				}
+			}
+		}
+		if n, ok := number(sch["minProperties"]); ok && float64(len(v)) < n {
+			report("expected at least %v properties, got %d", n, len(v))
+		}
+		if n, ok := number(sch["maxProperties"]); ok && float64(len(v)) > n {
+			report("expected at most %v properties, got %d", n, len(v))
+		}
+		for _, key := range sortedKeys(v) {
+			sub := path + "/" + escapePointer(key)
+			matched := false
+			if p, ok := props[key]; ok {
+				matched = true
+				s.validate(p, v[key], sub, out)
+			}
+			for pat, p := range patterns {
+				if re, err := regexp.Compile(pat); err == nil && re.MatchString(key) {
+					matched = true
+					s.validate(p, v[key], sub, out)
+				}
+			}
+			if matched {
+				continue
+			}
+			switch add := sch["additionalProperties"].(type) {
+			case bool:
+				if !add {
+					*out = append(*out, Violation{Path: sub, Message: "unknown property"})
+				}
+			case map[string]any:
+				s.validate(add, v[key], sub, out)
+			}
+		}
+
+	case []any:
+		if n, ok := number(sch["minItems"]); ok && float64(len(v)) < n {
+			report("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := number(sch["maxItems"]); ok && float64(len(v)) > n {
+			report("expected at most %v items, got %d", n, len(v))
+		}
+		if u, ok := sch["uniqueItems"].(bool); ok && u {
+			for i := range v {
+				for j := range i {
+					if reflect.DeepEqual(v[i], v[j]) {
+						report("items %d and %d are not unique", j, i)
+					}
+				}
+			}
+		}
+		prefix := schemaList(sch["prefixItems"])
+		items := sch["items"]
+		if tuple, ok := items.([]any); ok { // draft-07 tuple validation
+			prefix, items = tuple, sch["additionalItems"]
+		}
+		for i, item := range v {
+			sub := path + "/" + strconv.Itoa(i)
+			switch {
+			case i < len(prefix):
+				s.validate(prefix[i], item, sub, out)
+			case items != nil:
+				s.validate(items, item, sub, out)
+			}
+		}
+
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if m, ok := number(sch["minLength"]); ok && n < m {
+			report("expected at least %v characters, got %v", m, n)
+		}
+		if m, ok := number(sch["maxLength"]); ok && n > m {
+			report("expected at most %v characters, got %v", m, n)
+		}
+		if pat, ok := sch["pattern"].(string); ok {
+			if re, err := regexp.Compile(pat); err == nil && !re.MatchString(v) {
+				report("value %q does not match pattern %q", v, pat)
+			}
+		}
+
+	case float64:
+		if m, ok := number(sch["minimum"]); ok && v < m {
+			report("value %v is less than minimum %v", v, m)
+		}
+		if m, ok := number(sch["maximum"]); ok && v > m {
+			report("value %v is greater than maximum %v", v, m)
+		}
+		if m, ok := number(sch["exclusiveMinimum"]); ok && v <= m {
+			report("value %v is not greater than %v", v, m)
+		}
+		if m, ok := number(sch["exclusiveMaximum"]); ok && v >= m {
+			report("value %v is not less than %v", v, m)
+		}
+		if m, ok := number(sch["multipleOf"]); ok && m > 0 {
+			if q := v / m; q != math.Trunc(q) {
+				report("value %v is not a multiple of %v", v, m)
+			}
+		}
+	}
+}
+
+// count returns the number of schemas in subs that val conforms to.
+func (s *Schema) count(subs []any, val any, path string) int {
+	n := 0
+	for _, sub := range subs {
+		var tmp []Violation
+		s.validate(sub, val, path, &tmp)
+		if len(tmp) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// resolve returns the subschema identified by a local JSON pointer reference.
+func (s *Schema) resolve(ref string) (any, error) {
+	ptr, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported $ref %q", status.ErrInvalidSchema, ref)
+	}
+	node := s.root
+	if ptr == "" {
+		return node, nil
+	}
+	for _, tok := range strings.Split(strings.TrimPrefix(ptr, "/"), "/") {
+		tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+		switch n := node.(type) {
+		case map[string]any:
+			node, ok = n[tok]
+		case []any:
+			i, err := strconv.Atoi(tok)
+			ok = err == nil && i >= 0 && i < len(n)
+			if ok {
+				node = n[i]
+			}
+		default:
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: unresolved $ref %q", status.ErrInvalidSchema, ref)
+		}
+	}
+	return node, nil
+}
+
+func typeNames(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		names := make([]string, 0, len(t))
+		for _, n := range t {
+			if s, ok := n.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func isType(val any, name string) bool {
+	switch name {
+	case "integer":
+		f, ok := val.(float64)
+		return ok && f == math.Trunc(f)
+	case "number":
+		_, ok := val.(float64)
+		return ok
+	default:
+		return typeOf(val) == name
+	}
+}
+
+func typeOf(val any) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", val)
+}
+
+func schemaList(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+func number(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+func encodeValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
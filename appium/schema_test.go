@@ -0,0 +1,237 @@
+package appium
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+func decode(t *testing.T, text string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		t.Fatalf("%v:\n%s", err, text)
+	}
+	return v
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		want   []Violation
+	}{
+		// Boolean schemas
+		{"true", `true`, `{"a":1}`, nil},
+		{"false", `false`, `1`, []Violation{{"/", "value not allowed"}}},
+		{"false property", `{"properties":{"a":false}}`, `{"a":1}`,
+			[]Violation{{"/a", "value not allowed"}}},
+
+		// type
+		{"type", `{"type":"string"}`, `"x"`, nil},
+		{"type mismatch", `{"type":"string"}`, `1`,
+			[]Violation{{"/", "expected string, got number"}}},
+		{"type list", `{"type":["string","null"]}`, `null`, nil},
+		{"type list mismatch", `{"type":["string","null"]}`, `true`,
+			[]Violation{{"/", "expected string or null, got boolean"}}},
+		{"integer", `{"type":"integer"}`, `4723`, nil},
+		{"integer fraction", `{"type":"integer"}`, `1.5`,
+			[]Violation{{"/", "expected integer, got number"}}},
+		{"type mismatch stops", `{"type":"integer","minimum":10}`, `"x"`,
+			[]Violation{{"/", "expected integer, got string"}}},
+
+		// enum and const
+		{"enum", `{"enum":["info","debug"]}`, `"debug"`, nil},
+		{"enum mismatch", `{"enum":["info","debug"]}`, `"loud"`,
+			[]Violation{{"/", `value "loud" is not one of ["info","debug"]`}}},
+		{"const", `{"const":{"a":[1]}}`, `{"a":[1]}`, nil},
+		{"const mismatch", `{"const":{"a":[1]}}`, `{"a":[2]}`,
+			[]Violation{{"/", `value {"a":[2]} is not {"a":[1]}`}}},
+
+		// $ref
+		{"ref", `{"$defs":{"p":{"type":"integer"}},"properties":{"a":{"$ref":"#/$defs/p"}}}`,
+			`{"a":"x"}`, []Violation{{"/a", "expected integer, got string"}}},
+		{"ref escaped", `{"$defs":{"a/b~c":{"const":1}},"$ref":"#/$defs/a~1b~0c"}`, `2`,
+			[]Violation{{"/", "value 2 is not 1"}}},
+		{"ref array", `{"$defs":[{"const":1},{"const":2}],"$ref":"#/$defs/1"}`, `2`, nil},
+		{"ref root", `{"properties":{"next":{"$ref":"#"}},"required":["v"]}`, `{"v":1,"next":{}}`,
+			[]Violation{{"/next", `missing required property "v"`}}},
+		{"ref unresolved", `{"$ref":"#/$defs/none"}`, `1`,
+			[]Violation{{"/", `invalid JSON schema: unresolved $ref "#/$defs/none"`}}},
+		{"ref remote", `{"$ref":"other.json#/a"}`, `1`,
+			[]Violation{{"/", `invalid JSON schema: unsupported $ref "other.json#/a"`}}},
+
+		// Applicators
+		{"allOf", `{"allOf":[{"minimum":2},{"maximum":1}]}`, `3`,
+			[]Violation{{"/", "value 3 is greater than maximum 1"}}},
+		{"anyOf", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `1`, nil},
+		{"anyOf mismatch", `{"anyOf":[{"type":"string"},{"type":"integer"}]}`, `true`,
+			[]Violation{{"/", "value does not match any allowed schema (anyOf)"}}},
+		{"oneOf", `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, `"x"`, nil},
+		{"oneOf none", `{"oneOf":[{"type":"string"},{"type":"integer"}]}`, `true`,
+			[]Violation{{"/", "value matches 0 schemas, expected exactly 1 (oneOf)"}}},
+		{"oneOf many", `{"oneOf":[{"type":"number"},{"type":"integer"}]}`, `1`,
+			[]Violation{{"/", "value matches 2 schemas, expected exactly 1 (oneOf)"}}},
+		{"not", `{"not":{"type":"null"}}`, `1`, nil},
+		{"not mismatch", `{"not":{"type":"null"}}`, `null`,
+			[]Violation{{"/", "value matches a disallowed schema (not)"}}},
+		{"if then", `{"if":{"type":"string"},"then":{"minLength":2},"else":{"minimum":2}}`, `"x"`,
+			[]Violation{{"/", "expected at least 2 characters, got 1"}}},
+		{"if else", `{"if":{"type":"string"},"then":{"minLength":2},"else":{"minimum":2}}`, `1`,
+			[]Violation{{"/", "value 1 is less than minimum 2"}}},
+		{"if without else", `{"if":{"type":"string"},"then":{"minLength":2}}`, `1`, nil},
+
+		// Objects
+		{"required", `{"required":["a","b"]}`, `{"a":1}`,
+			[]Violation{{"/", `missing required property "b"`}}},
+		{"minProperties", `{"minProperties":2}`, `{"a":1}`,
+			[]Violation{{"/", "expected at least 2 properties, got 1"}}},
+		{"maxProperties", `{"maxProperties":1}`, `{"a":1,"b":2}`,
+			[]Violation{{"/", "expected at most 1 properties, got 2"}}},
+		{"additionalProperties false", `{"properties":{"a":{}},"additionalProperties":false}`,
+			`{"a":1,"b/c":2}`, []Violation{{"/b~1c", "unknown property"}}},
+		{"additionalProperties schema", `{"properties":{"a":{}},"additionalProperties":{"type":"string"}}`,
+			`{"a":1,"b":2}`, []Violation{{"/b", "expected string, got number"}}},
+		{"patternProperties", `{"patternProperties":{"^x-":{"type":"string"}},"additionalProperties":false}`,
+			`{"x-a":1,"y":2}`, []Violation{
+				{"/x-a", "expected string, got number"},
+				{"/y", "unknown property"},
+			}},
+		{"properties and patternProperties", `{"properties":{"x-a":{"minimum":2}},"patternProperties":{"^x-":{"maximum":0}}}`,
+			`{"x-a":1}`, []Violation{
+				{"/x-a", "value 1 is less than minimum 2"},
+				{"/x-a", "value 1 is greater than maximum 0"},
+			}},
+		{"nested", `{"properties":{"a":{"properties":{"b":{"items":{"type":"string"}}}}}}`,
+			`{"a":{"b":["x",1]}}`, []Violation{{"/a/b/1", "expected string, got number"}}},
+
+		// Arrays
+		{"minItems", `{"minItems":2}`, `[1]`,
+			[]Violation{{"/", "expected at least 2 items, got 1"}}},
+		{"maxItems", `{"maxItems":1}`, `[1,2]`,
+			[]Violation{{"/", "expected at most 1 items, got 2"}}},
+		{"uniqueItems", `{"uniqueItems":true}`, `["a",{"b":1},"a",{"b":1}]`, []Violation{
+			{"/", "items 0 and 2 are not unique"},
+			{"/", "items 1 and 3 are not unique"},
+		}},
+		{"uniqueItems false", `{"uniqueItems":false}`, `[1,1]`, nil},
+		{"items", `{"items":{"type":"integer"}}`, `[1,"x",2.5]`, []Violation{
+			{"/1", "expected integer, got string"},
+			{"/2", "expected integer, got number"},
+		}},
+		{"items tuple", `{"items":[{"type":"string"},{"type":"integer"}],"additionalItems":false}`,
+			`["x",1,null]`, []Violation{{"/2", "value not allowed"}}},
+		{"prefixItems", `{"prefixItems":[{"type":"string"}],"items":{"type":"integer"}}`,
+			`[1,"x"]`, []Violation{
+				{"/0", "expected string, got number"},
+				{"/1", "expected integer, got string"},
+			}},
+
+		// Strings
+		{"minLength", `{"minLength":3}`, `"añ"`,
+			[]Violation{{"/", "expected at least 3 characters, got 2"}}},
+		{"maxLength", `{"maxLength":1}`, `"añ"`,
+			[]Violation{{"/", "expected at most 1 characters, got 2"}}},
+		{"pattern", `{"pattern":"^[0-9]+(\\.[0-9]+)*$"}`, `"17.4"`, nil},
+		{"pattern mismatch", `{"pattern":"^[0-9]+$"}`, `"17.x"`,
+			[]Violation{{"/", `value "17.x" does not match pattern "^[0-9]+$"`}}},
+		{"string bounds ignore numbers", `{"minLength":3,"pattern":"^x"}`, `1`, nil},
+
+		// Numbers
+		{"minimum", `{"minimum":1}`, `1`, nil},
+		{"minimum mismatch", `{"minimum":1}`, `0`,
+			[]Violation{{"/", "value 0 is less than minimum 1"}}},
+		{"maximum mismatch", `{"maximum":65535}`, `70000`,
+			[]Violation{{"/", "value 70000 is greater than maximum 65535"}}},
+		{"exclusiveMinimum", `{"exclusiveMinimum":1}`, `1`,
+			[]Violation{{"/", "value 1 is not greater than 1"}}},
+		{"exclusiveMaximum", `{"exclusiveMaximum":1}`, `1`,
+			[]Violation{{"/", "value 1 is not less than 1"}}},
+		{"multipleOf", `{"multipleOf":0.5}`, `2.5`, nil},
+		{"multipleOf mismatch", `{"multipleOf":2}`, `3`,
+			[]Violation{{"/", "value 3 is not a multiple of 2"}}},
+
+		// Annotations are not asserted.
+		{"annotations", `{"format":"hostname","default":"0.0.0.0","description":"x"}`, `"not a host!"`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sch, err := ParseSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sch.Validate(decode(t, tt.doc)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate(%s):\ngot  %q\nwant %q", tt.doc, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	sch, err := ParseSchema([]byte(`{"properties":{"a":{"type":"string"},"b":{"type":"string"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sch.Check(decode(t, `{"a":"x"}`)); err != nil {
+		t.Errorf("Check(valid) = %v", err)
+	}
+	err = sch.Check(decode(t, `{"a":1,"b":2}`))
+	if !errors.Is(err, status.ErrSchemaViolation) {
+		t.Fatalf("Check(invalid) = %v, want %v", err, status.ErrSchemaViolation)
+	}
+	for _, want := range []Violation{{"/a", "expected string, got number"}, {"/b", "expected string, got number"}} {
+		if !errors.Is(err, want) {
+			t.Errorf("Check(invalid) = %v, does not include %v", err, want)
+		}
+	}
+}
+
+func TestParseSchemaInvalid(t *testing.T) {
+	if _, err := ParseSchema([]byte(`{"type":`)); !errors.Is(err, status.ErrInvalidJSON) {
+		t.Errorf("ParseSchema(invalid JSON) = %v, want %v", err, status.ErrInvalidJSON)
+	}
+}
+
+// TestDefaultSchema checks a generated config.json and a config.json with one
+// error of each kind against the schema bundled with the agent.
+func TestDefaultSchema(t *testing.T) {
+	sch, err := DefaultSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := readFile(t, filepath.Join("testdata", "device-name.json"))
+	if vs := sch.Validate(good); len(vs) != 0 {
+		t.Errorf("Validate(testdata/device-name.json) = %q, want no violations", vs)
+	}
+	bad := decode(t, `{
+		"server": {
+			"port": 70000,
+			"address": 4723,
+			"log-level": "loud",
+			"allow-insecure": ["adb_shell", "adb_shell"],
+			"keep-alive-timeout": 1.5,
+			"default-capabilities": {"appium:options": {"any": "thing"}},
+			"colour": true
+		},
+		"client": {}
+	}`)
+	want := []Violation{
+		{"/client", "unknown property"},
+		{"/server/address", "expected string, got number"},
+		{"/server/allow-insecure", "items 0 and 1 are not unique"},
+		{"/server/colour", "unknown property"},
+		{"/server/keep-alive-timeout", "expected integer, got number"},
+		{"/server/log-level", `value "loud" is not one of ["info","info:debug","info:info","info:warn",` +
+			`"info:error","warn","warn:debug","warn:info","warn:warn","warn:error","error","error:debug",` +
+			`"error:info","error:warn","error:error","debug","debug:debug","debug:info","debug:warn","debug:error"]`},
+		{"/server/port", "value 70000 is greater than maximum 65535"},
+	}
+	if got := sch.Validate(bad); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate(bad):\ngot  %q\nwant %q", got, want)
+	}
+}
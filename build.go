@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/xcode"
+)
+
+func addBuildFlags(a *agent, fset *flag.FlagSet) {
+	addConfigFlags(a, fset)
+	fset.BoolVarP(&a.dryRun, "dryrun", "y", false,
+		"Print the xcodebuild command without running it")
+}
+
+// runBuild builds and runs the test driver (WebDriverAgent) with xcodebuild.
+func runBuild(a *agent, _ []string) error {
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+	if err := a.validate(); err != nil {
+		return err
+	}
+	b, err := xcode.NewBuild(a.cfg)
+	if err != nil {
+		return fmt.Errorf("configure xcodebuild: %w", err)
+	}
+	if err = b.Validate(); err != nil {
+		return fmt.Errorf("configure xcodebuild: %w", err)
+	}
+	if a.dryRun || a.verbose {
+		fmt.Println(b)
+	}
+	if a.dryRun {
+		return nil
+	}
+	exe := b.Command()
+	exe.Stdin, exe.Stdout, exe.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = exe.Run(); err != nil {
+		return fmt.Errorf("%s: %w", xcode.Xcodebuild, err)
+	}
+	return nil
+}
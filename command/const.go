@@ -5,6 +5,7 @@ import "path/filepath"
 const (
 	AppiumdConfigIdent = "appium_config_env"
 	RestartAppiumIdent = "appium_restart"
+	AgentExecIdent     = "appium_agent"
 )
 
 const (
@@ -14,3 +15,30 @@ const (
 var AppiumdDefaultInit = func(root string) string { //nolint:gochecknoglobals
 	return filepath.Join(root, "libexec", "appiumd.zsh")
 }
+
+var AppiumdSessionLog = func(root string) string { //nolint:gochecknoglobals
+	return filepath.Join(root, "var", "log", "appium", "session.log")
+}
+
+var AppiumdDriverLog = func(root string) string { //nolint:gochecknoglobals
+	return filepath.Join(root, "var", "log", "appium", "driver.log")
+}
+
+var AppiumdConfigJSON = func(root string) string { //nolint:gochecknoglobals
+	return filepath.Join(root, "etc", "appium", "config.json")
+}
+
+// AppiumdConfigLock guards writes to Appium's config.json. It is kept with the
+// agent's other runtime files rather than next to config.json, which belongs
+// to Appium.
+var AppiumdConfigLock = func(root string) string { //nolint:gochecknoglobals
+	return filepath.Join(root, "var", "run", "appium", "config.json.lock")
+}
+
+var AppiumdStateFile = func(root string) string { //nolint:gochecknoglobals
+	return filepath.Join(root, "var", "run", "appium", "appiumd.json")
+}
+
+var AppiumdPIDFile = func(root string) string { //nolint:gochecknoglobals
+	return filepath.Join(root, "var", "run", "appium", "appiumd.pid")
+}
@@ -108,3 +108,8 @@ func ParseShebangFrom(path string) (string, []string, error) {
 func KillAll(cmd *exec.Cmd) error {
 	return exec.Command("tmux", "kill-session", "-t", AppiumdTmuxSession).Run()
 }
+
+// Exists reports whether the tmux session hosting Appium is running.
+func Exists() bool {
+	return exec.Command("tmux", "has-session", "-t", AppiumdTmuxSession).Run() == nil
+}
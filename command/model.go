@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/ardnew/appium-agent/status"
 )
@@ -55,3 +56,14 @@ func (m Model) Command() (string, []string) {
 	arg = append(arg, flag.Args()...)
 	return m.ShellPath, arg
 }
+
+// Root returns the installation prefix containing the Appium init script,
+// i.e., the directory that contains "libexec/appiumd.zsh".
+func (m Model) Root() string {
+	if !filepath.IsAbs(m.ScriptPath) {
+		if root, ok := os.LookupEnv("FSDS_PREFIX"); ok {
+			return root
+		}
+	}
+	return filepath.Dir(filepath.Dir(m.ScriptPath))
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Snapshot is a timestamped backup of the installed configuration.
+type Snapshot struct {
+	ID        string // timestamp of the backup, e.g., "20240102-150405"
+	Path      string
+	Generated string // "Generated on" date recorded in the file header
+	Command   string // command-line recorded in the file header
+}
+
+var backupID = regexp.MustCompile(`^\d{8}-\d{6}(-\d+)?$`)
+
+// backupName splits the base name of source around which a backup ID is
+// inserted, e.g., "config.env" yields "config." and ".env".
+func backupName(source string) (prefix, suffix string) {
+	base := filepath.Base(source)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + ".", ext
+}
+
+// Backups returns the backups of source in dir, ordered from oldest to newest.
+func Backups(source, dir string) ([]Snapshot, error) {
+	ent, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrReadFile, dir, err)
+	}
+	prefix, suffix := backupName(source)
+	var snap []Snapshot
+	for _, e := range ent {
+		id, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		if id, ok = strings.CutSuffix(id, suffix); !ok || !backupID.MatchString(id) {
+			continue
+		}
+		s := Snapshot{ID: id, Path: filepath.Join(dir, e.Name())}
+		s.Generated, s.Command = readHeader(s.Path)
+		snap = append(snap, s)
+	}
+	slices.SortFunc(snap, func(a, b Snapshot) int { return compareID(a.ID, b.ID) })
+	return snap, nil
+}
+
+// FindBackup returns the backup of source in dir with the given ID,
+// or the most recent backup if id is empty.
+func FindBackup(source, dir, id string) (Snapshot, error) {
+	snap, err := Backups(source, dir)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snap) == 0 {
+		return Snapshot{}, fmt.Errorf("%w: no backups in %q", status.ErrInvalidBackup, dir)
+	}
+	if id == "" {
+		return snap[len(snap)-1], nil
+	}
+	for _, s := range snap {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("%w: no backup with ID %q", status.ErrInvalidBackup, id)
+}
+
+// Backup copies source into a new timestamped backup in dir and then removes
+// all but the keep most recent backups. It returns the new backup's path.
+//
+// Nothing is copied and no error is returned if source does not exist.
+func Backup(source, dir string, keep int) (string, error) {
+	if source == "" || dir == "" {
+		return "", nil
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil // nothing installed yet
+		}
+		return "", fmt.Errorf("%w: %q: %w", status.ErrOpenFile, source, err)
+	}
+	defer in.Close()
+
+	prefix, suffix := backupName(source)
+	id := time.Now().Format(BackupTimeLayout)
+	path := filepath.Join(dir, prefix+id+suffix)
+	for n := 1; ; n++ {
+		if _, err = os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = filepath.Join(dir, prefix+id+"-"+strconv.Itoa(n)+suffix)
+	}
+	if err = WriteAtomic(path, 0o644, func(w io.Writer) error { //nolint:gomnd,mnd
+		_, cerr := io.Copy(w, in)
+		return cerr
+	}); err != nil {
+		return "", fmt.Errorf("backup: %q -> %q: %w", source, path, err)
+	}
+	return path, Prune(source, dir, keep)
+}
+
+// Prune removes all but the keep most recent backups of source in dir.
+func Prune(source, dir string, keep int) error {
+	snap, err := Backups(source, dir)
+	if err != nil {
+		return err
+	}
+	for len(snap) > max(keep, 1) {
+		if err = os.Remove(snap[0].Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: prune backup: %q: %w", status.ErrWriteFile, snap[0].Path, err)
+		}
+		snap = snap[1:]
+	}
+	return nil
+}
+
+// Rollback replaces source with the given backup,
+// after first creating a backup of source itself.
+func Rollback(source, dir string, snap Snapshot, keep int) error {
+	lock, err := AcquireLock(source)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	// Read the backup first, since pruning may remove it.
+	b, err := os.ReadFile(snap.Path)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrReadFile, snap.Path, err)
+	}
+	if _, err = Backup(source, dir, keep); err != nil {
+		return err
+	}
+	return WriteAtomic(source, 0o644, func(w io.Writer) error { //nolint:gomnd,mnd
+		_, werr := w.Write(b)
+		return werr
+	})
+}
+
+// readHeader returns the date and command-line recorded in the header
+// written by Model.Write, if any.
+func readHeader(path string) (generated, command string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for line := 0; scan.Scan() && line < 16; line++ { //nolint:gomnd,mnd
+		text := strings.TrimSpace(strings.TrimPrefix(scan.Text(), "#"))
+		if date, ok := strings.CutPrefix(text, "Generated on "); ok {
+			generated = strings.TrimSuffix(date, " with:")
+			if scan.Scan() {
+				command = strings.TrimSpace(strings.TrimPrefix(scan.Text(), "#"))
+				if args, uerr := unquoteArgs(command); uerr == nil {
+					command = args
+				}
+			}
+			return generated, command
+		}
+	}
+	return "", ""
+}
+
+// unquoteArgs converts a command-line formatted with %q (e.g., `["a" "b c"]`)
+// to a space-separated string.
+func unquoteArgs(s string) (string, error) {
+	s, ok := strings.CutPrefix(s, "[")
+	if !ok {
+		return "", strconv.ErrSyntax
+	}
+	s, ok = strings.CutSuffix(s, "]")
+	if !ok {
+		return "", strconv.ErrSyntax
+	}
+	var args []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		q, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", err
+		}
+		arg, _ := strconv.Unquote(q)
+		if strings.ContainsAny(arg, " \t'\"") {
+			arg = strconv.Quote(arg)
+		}
+		args = append(args, arg)
+		s = s[len(q):]
+	}
+	return strings.Join(args, " "), nil
+}
+
+// compareID orders backup IDs by timestamp and then by sequence number.
+func compareID(a, b string) int {
+	ta, na := splitID(a)
+	tb, nb := splitID(b)
+	if c := strings.Compare(ta, tb); c != 0 {
+		return c
+	}
+	return na - nb
+}
+
+func splitID(id string) (string, int) {
+	if len(id) > len(BackupTimeLayout) {
+		n, _ := strconv.Atoi(id[len(BackupTimeLayout)+1:])
+		return id[:len(BackupTimeLayout)], n
+	}
+	return id, 0
+}
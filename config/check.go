@@ -0,0 +1,238 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Constraint returns an error describing why the value s of a Var is invalid,
+// or nil if it is valid.
+//
+// Constraints are not applied to blank values or command substitutions,
+// which are only known once the configuration is sourced by the shell.
+type Constraint func(s string) error
+
+// Rule returns all violations of a constraint spanning multiple variables.
+type Rule func(m *Model) []error
+
+var (
+	versionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+){0,2}$`)
+	bundlePattern  = regexp.MustCompile(`^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$`)
+	udidPattern    = regexp.MustCompile(`^(` +
+		`[0-9A-Fa-f]{8}-[0-9A-Fa-f]{16}|` + // devices since iPhone XS
+		`[0-9A-Fa-f]{40}|` + // earlier devices
+		`[0-9A-Fa-f]{8}-([0-9A-Fa-f]{4}-){3}[0-9A-Fa-f]{12})$`) // simulators
+)
+
+// destinationKeys are the keys of an xcodebuild(1) -destination specifier.
+var destinationKeys = []string{"id", "platform", "name", "OS", "arch", "variant"} //nolint:gochecknoglobals
+
+// XcodebuildActions lists the xcodebuild(1) build actions.
+var XcodebuildActions = []string{ //nolint:gochecknoglobals
+	"build", "build-for-testing", "analyze", "archive", "test",
+	"test-without-building", "docbuild", "installsrc", "install", "clean",
+}
+
+// PortRange requires an integer in the range [lo, hi].
+func PortRange(lo, hi int) Constraint {
+	return func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < lo || n > hi {
+			return fmt.Errorf("expected a TCP port in %d-%d", lo, hi)
+		}
+		return nil
+	}
+}
+
+// DottedVersion requires a dotted version number, e.g., "17" or "17.4.1".
+func DottedVersion(s string) error {
+	if !versionPattern.MatchString(s) {
+		return errors.New("expected a version, e.g., 17.4")
+	}
+	return nil
+}
+
+// BundleID requires a reverse-DNS bundle identifier, e.g., "com.example.App".
+func BundleID(s string) error {
+	if !bundlePattern.MatchString(s) {
+		return errors.New("expected a reverse-DNS bundle ID, e.g., com.example.App")
+	}
+	return nil
+}
+
+// Destination requires a device UDID, an xcodebuild(1) destination specifier
+// (e.g., "id=UDID" or "platform=iOS,name=iPhone"), or a device name.
+func Destination(s string) error {
+	if !strings.Contains(s, "=") {
+		return nil // either a UDID or a device name
+	}
+	for _, kv := range strings.Split(s, ",") {
+		k, v, _ := strings.Cut(kv, "=")
+		switch {
+		case !slices.Contains(destinationKeys, k):
+			return fmt.Errorf("unknown destination key %q (expected one of %s)",
+				k, strings.Join(destinationKeys, ", "))
+		case v == "":
+			return fmt.Errorf("empty destination value for %q", k)
+		case k == "id" && !udidPattern.MatchString(v):
+			return fmt.Errorf("expected a device UDID, got %q", v)
+		}
+	}
+	return nil
+}
+
+// Exists requires the path of an existing file or directory.
+func Exists(s string) error {
+	if _, err := os.Stat(s); err != nil {
+		return errors.Unwrap(err) // drop the path repeated by *fs.PathError
+	}
+	return nil
+}
+
+// JSONObject requires a JSON object, e.g., {"newCommandTimeout": 300}.
+func JSONObject(s string) error {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(s), &obj); err != nil || obj == nil {
+		return errors.New("expected a JSON object")
+	}
+	return nil
+}
+
+// Check returns an error wrapping status.ErrInvalidValue for each constraint
+// of v that its value violates. The constraints of an aggregate variable
+// apply to each of its items.
+func (v *Var) Check() []error {
+	s := strings.TrimSpace(v.String())
+	if s == "" || IsCommandSubst(s) {
+		return nil
+	}
+	items := []string{s}
+	if v.Aggr {
+		items = v.List()
+	}
+	var errs []error
+	for _, item := range items {
+		for _, c := range v.Constraints {
+			if err := c(item); err != nil {
+				errs = append(errs, fmt.Errorf("%w: --%s=%q: %w", status.ErrInvalidValue, v.Flag, item, err))
+			}
+		}
+	}
+	return errs
+}
+
+// BuildSetting requires an xcodebuild(1) build setting, e.g., "KEY=value".
+func BuildSetting(s string) error {
+	k, _, ok := strings.Cut(s, "=")
+	if !ok || !isIdent(k) {
+		return errors.New("expected a build setting, e.g., SWIFT_VERSION=5")
+	}
+	return nil
+}
+
+// DefaultRules returns the constraints spanning multiple variables.
+func DefaultRules() []Rule {
+	return []Rule{
+		distinct("bundled_app", "bundled_drv"),
+		distinct("listen_port", "driver_port"),
+		notAfter("ios_version", "sdk_version"),
+	}
+}
+
+// literal returns the value of the variable ident, unless it is blank or
+// a command substitution.
+func (e Env) literal(ident string) (*Var, string, bool) {
+	v, ok := e.Lookup(ident)
+	if !ok {
+		return nil, "", false
+	}
+	s := strings.TrimSpace(v.String())
+	return v, s, s != "" && !IsCommandSubst(s)
+}
+
+// distinct requires the variables a and b to differ.
+func distinct(a, b string) Rule {
+	return func(m *Model) []error {
+		va, sa, oka := m.Env.literal(a)
+		vb, sb, okb := m.Env.literal(b)
+		if oka && okb && sa == sb {
+			return []error{fmt.Errorf("%w: --%s and --%s must differ (both %q)",
+				status.ErrInvalidValue, va.Flag, vb.Flag, sa)}
+		}
+		return nil
+	}
+}
+
+// version returns the version number of the variable ident, expanding a
+// command substitution that may be executed (see Model.Expand).
+//
+// It returns false without an error if the value is blank, is a command
+// substitution that may not be executed, or is not a version, since Validate
+// reports each of these on its own. An error is returned only if a command
+// substitution fails or does not output a version.
+func (m *Model) version(ident string) (*Var, string, bool, error) {
+	v, s, ok := m.Env.literal(ident)
+	if v == nil || ok {
+		return v, s, ok && DottedVersion(s) == nil, nil
+	}
+	if s = strings.TrimSpace(v.String()); s == "" || !m.execAllowed(v, s) {
+		return v, "", false, nil
+	}
+	out, err := ExpandCommandSubst(s)
+	if err != nil {
+		return v, "", false, err
+	}
+	if out = strings.TrimSpace(out); DottedVersion(out) != nil {
+		return v, "", false, fmt.Errorf("%w: --%s=%q: expected a version, got %q",
+			status.ErrInvalidValue, v.Flag, s, out)
+	}
+	return v, out, true, nil
+}
+
+// notAfter requires the version a to be less than or equal to the version b.
+// The rule is reported as not evaluated if either version is a command
+// substitution that fails.
+func notAfter(a, b string) Rule {
+	return func(m *Model) []error {
+		va, sa, oka, erra := m.version(a)
+		vb, sb, okb, errb := m.version(b)
+		if err := errors.Join(erra, errb); err != nil {
+			return []error{fmt.Errorf("--%s not compared with --%s: %w", va.Flag, vb.Flag, err)}
+		}
+		if !oka || !okb {
+			return nil
+		}
+		if CompareVersions(sa, sb) > 0 {
+			return []error{fmt.Errorf("%w: --%s=%s exceeds --%s=%s",
+				status.ErrInvalidValue, va.Flag, sa, vb.Flag, sb)}
+		}
+		return nil
+	}
+}
+
+// CompareVersions compares two dotted version numbers, treating missing
+// components as zero, e.g., "17" equals "17.0".
+func CompareVersions(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := range max(len(pa), len(pb)) {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			return na - nb
+		}
+	}
+	return 0
+}
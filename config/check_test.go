@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// fakeXcrun prepends to PATH an xcrun(1) that runs script.
+func fakeXcrun(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "xcrun"), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// TestNotAfterDefaultSDK checks ios_version against the default sdk_version,
+// a command substitution that runs xcrun(1).
+func TestNotAfterDefaultSDK(t *testing.T) {
+	tests := []struct {
+		name      string
+		xcrun     string
+		allowExec bool
+		ios       string
+		want      error // nil if the rule holds
+		message   string
+	}{
+		{"older", "echo 17.4", false, "17.2", nil, ""},
+		{"equal", "echo 17.4", false, "17.4.0", nil, ""},
+		{"newer", "echo 17.4", false, "18.0", status.ErrInvalidValue,
+			`--ios-version=18.0 exceeds --sdk-version=17.4`},
+		{"xcrun fails", "exit 1", false, "18.0", status.ErrCommandSubst,
+			"--ios-version not compared with --sdk-version"},
+		{"not a version", "echo unknown", true, "18.0", status.ErrInvalidValue,
+			`expected a version, got "unknown"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeXcrun(t, tt.xcrun)
+			m := newModel(t, tt.allowExec, "ios_version", tt.ios)
+			if v, _ := m.Env.Lookup("sdk_version"); !IsCommandSubst(v.String()) {
+				t.Fatalf("sdk_version = %q, want the default command substitution", v.String())
+			}
+			errs := notAfter("ios_version", "sdk_version")(m)
+			if tt.want == nil {
+				if len(errs) != 0 {
+					t.Errorf("notAfter() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !errors.Is(errs[0], tt.want) || !strings.Contains(errs[0].Error(), tt.message) {
+				t.Errorf("notAfter() = %v, want %v containing %q", errs, tt.want, tt.message)
+			}
+			if err := m.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestNotAfterDenied checks that a command substitution that may not be
+// executed is never run to evaluate the rule; Validate reports it instead.
+func TestNotAfterDenied(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "executed")
+	m := newModel(t, false, "sdk_version", "$( touch "+marker+" && echo 17.4 )")
+	if v, _ := m.Env.Lookup("ios_version"); v.Set("18.0") != nil {
+		t.Fatal("cannot set ios_version")
+	}
+	if errs := notAfter("ios_version", "sdk_version")(m); len(errs) != 0 {
+		t.Errorf("notAfter() = %v, want no errors", errs)
+	}
+	if err := m.Validate(); !errors.Is(err, status.ErrExecDenied) {
+		t.Errorf("Validate() = %v, want %v", err, status.ErrExecDenied)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("denied command substitution was executed")
+	}
+}
@@ -4,6 +4,26 @@ const (
 	SourceIdent = "FSDS_CONFIG_APPIUM_ENV"
 	BackupIdent = "FSDS_CONFIG_APPIUM_ENV_BACKUP"
 	TmpCfgIdent = "FSDS_CONFIG_APPIUM_ENV_TEMP"
+
+	BackupKeepIdent = "FSDS_CONFIG_APPIUM_ENV_BACKUP_KEEP"
+)
+
+const (
+	DefaultBackupKeep = 10 // number of backups to keep
+	BackupTimeLayout  = "20060102-150405"
+)
+
+const (
+	ProfileDir = "profiles"
+	ProfileExt = ".env"
+)
+
+// Configuration layers, applied before any --config-file or profile.
+const (
+	SystemLayerFile  = "defaults.env"      // in the directory of config.json
+	UserLayerDir     = "appium-agent"      // in $XDG_CONFIG_HOME
+	UserLayerFile    = "config.env"        // in UserLayerDir
+	ProjectLayerFile = ".appium-agent.env" // in target-app-source or a parent
 )
 
 const (
@@ -11,6 +31,11 @@ const (
 	DefaultEnvQuote = '\''
 )
 
+// ListSep separates the items of an aggregate variable in config.env and in
+// the environment. A delimited string (rather than a shell array) is used so
+// that the value can be exported to and inherited from the environment.
+const ListSep = ","
+
 const (
 	// The output is separated into 2 vertical regions
 	// that separate the syntax placeholder and the usage description:
@@ -33,3 +58,14 @@ const (
 	synlen uint = collen - padlen   // total width of the first alignable region
 	lalign uint = padlen / 2        // first column of the first region
 )
+
+// Formats of the resolved configuration printed by "config show" and --dryrun.
+const (
+	OutputEnv  = "env"  // config.env (shell) syntax
+	OutputJSON = "json" // Report encoded as JSON
+)
+
+// ReportVersion is the version of the Report schema. It is incremented
+// whenever a field is removed or its meaning changes; fields may be added
+// without changing the version.
+const ReportVersion = 1
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ChangeKind classifies the difference of a single variable.
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota + 1
+	Removed
+	Changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return ""
+}
+
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Change is the difference of a single variable between two environments.
+type Change struct {
+	Ident string     `json:"ident"`
+	Flag  string     `json:"flag"`
+	Kind  ChangeKind `json:"change"`
+	Old   string     `json:"old"`
+	New   string     `json:"new"`
+}
+
+// Diff compares the effective values of a and b by ident
+// and returns the changes from a to b, in the order of b.
+//
+// A variable with an empty value is considered undefined.
+func Diff(a, b Env) []Change {
+	var out []Change
+	value := func(e Env, ident string) string {
+		if v, ok := e.Get(func(v *Var) bool { return v.Ident == ident }); ok {
+			return v.String()
+		}
+		return ""
+	}
+	seen := map[string]bool{}
+	check := func(v *Var) {
+		if seen[v.Ident] {
+			return
+		}
+		seen[v.Ident] = true
+		c := Change{Ident: v.Ident, Flag: v.Flag, Old: value(a, v.Ident), New: value(b, v.Ident)}
+		switch {
+		case c.Old == c.New:
+			return
+		case c.Old == "":
+			c.Kind = Added
+		case c.New == "":
+			c.Kind = Removed
+		default:
+			c.Kind = Changed
+		}
+		out = append(out, c)
+	}
+	for _, v := range b {
+		check(v)
+	}
+	for _, v := range a {
+		check(v)
+	}
+	return out
+}
+
+// FileEnv returns the environment defined only by the config.env file
+// at path, without defaults or values inherited from the environment.
+func FileEnv(path string) (Env, error) {
+	env := DefaultEnv()
+	for _, v := range env {
+		v.Value, v.EnvValue = nil, nil
+		v.Orphan = true
+	}
+	if err := env.LoadFile(path, SourceFile); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// WriteDiff writes the changes in a unified, human-readable format.
+func WriteDiff(out io.Writer, from, to string, change []Change) error {
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", from, to)
+	for _, c := range change {
+		var err error
+		switch c.Kind {
+		case Added:
+			_, err = fmt.Fprintf(out, "+ %s (--%s) = %s\n", c.Ident, c.Flag, strconv.Quote(c.New))
+		case Removed:
+			_, err = fmt.Fprintf(out, "- %s (--%s) = %s\n", c.Ident, c.Flag, strconv.Quote(c.Old))
+		case Changed:
+			_, err = fmt.Fprintf(out, "~ %s (--%s) = %s -> %s\n",
+				c.Ident, c.Flag, strconv.Quote(c.Old), strconv.Quote(c.New))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteDiffJSON writes the changes as a JSON object for use by other tools.
+func WriteDiffJSON(out io.Writer, from, to string, change []Change) error {
+	if change == nil {
+		change = []Change{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		From    string   `json:"from"`
+		To      string   `json:"to"`
+		Changes []Change `json:"changes"`
+	}{from, to, change})
+}
@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/muesli/reflow/indent"
 	"github.com/muesli/reflow/wordwrap"
+
+	"github.com/ardnew/appium-agent/status"
 )
 
 type Env []*Var
@@ -20,36 +23,50 @@ func DefaultEnv() Env {
 	env = append(env, NewVar("sdk-version", "k", "sdk_version", String,
 		"$( xcrun --sdk iphoneos --show-sdk-version )",
 		"Specify the iOS/iPadOS SDK platform `version` used by WebDriverAgent compilation host",
-		"(see: xcrun(1), xcode-select(1))"))
-	env = append(env, NewVar("ios-version", "o", "ios_version", String,
+		"(see: xcrun(1), xcode-select(1))").Require(DottedVersion).ExecDefault())
+	env = append(env, NewVar("ios-version", "o", "ios_version", Version,
 		"13.2",
 		"Specify the deployment target iOS/iPadOS `version`",
 		"(build setting: IPHONEOS_DEPLOYMENT_TARGET)"))
 
 	env = append(env, NewVar("target-device", "d", "target_dest", String,
 		"id=00008101-0005499E010B001E",
-		"Target `UUID` of the device under test"))
+		"Target `device` under test, either \"id=UDID\" or its name (see: devices)").Require(Destination))
 
 	env = append(env, NewVar("listen-network", "n", "listen_name", String,
 		"en5",
-		"Network `interface` of the Appium REST server"))
+		"Network `interface` (name, IP address or CIDR network) of the Appium REST server"))
+	env = append(env, NewVar("listen-ipv6", "6", "listen_ipv6", Bool,
+		false,
+		"Allow an IPv6 address of the network interface of the Appium REST server"))
 	env = append(env, NewVar("listen-port", "l", "listen_port", Int,
 		4723,
-		"TCP `port` of the Appium REST server"))
+		"TCP `port` of the Appium REST server").Require(PortRange(1, 65535)))
 	env = append(env, NewVar("wda-port", "t", "driver_port", Int,
 		8100,
-		"Connect to WebDriverAgent listening on TCP `port`"))
+		"Connect to WebDriverAgent listening on TCP `port`").Require(PortRange(1, 65535)))
 
-	env = append(env, NewVar("target-app-source", "p", "proj_source", String,
+	env = append(env, NewAggregrateVar("use-drivers", "D", "use_drivers", String,
+		"Activate only the Appium `driver` (may be repeated or comma-separated;",
+		"default: all installed drivers)"))
+	env = append(env, NewAggregrateVar("use-plugins", "U", "use_plugins", String,
+		"Activate the Appium `plugin` (may be repeated or comma-separated)"))
+	env = append(env, NewAggregrateVar("allow-insecure", "A", "allow_insecure", String,
+		"Allow the insecure Appium `feature` (may be repeated or comma-separated)"))
+
+	env = append(env, NewVar("target-app-source", "p", "proj_source", Path,
 		"",
-		"Directory `path` of the target app source code"))
+		"Directory `path` of the target app source code").Require(Exists))
 
 	env = append(env, NewVar("target-app-scheme", "s", "proj_scheme", String,
 		"FMPS Calculator",
 		"Build target app using `scheme` defined in Xcode project file"))
-	env = append(env, NewVar("xcodebuild-action", "x", "xcbuild_act", String,
-		"test",
-		"Run xcodebuild(1) `action` on the target app source code"))
+	env = append(env, NewAggregrateVar("xcodebuild-action", "x", "xcbuild_act", Enum,
+		"Run xcodebuild(1) `action` on the target app source code",
+		"(may be repeated or comma-separated)").Allow(XcodebuildActions...).Default([]string{"test"}))
+	env = append(env, NewAggregrateVar("xcodebuild-setting", "X", "xcbuild_set", String,
+		"Add the build `setting` (KEY=value) to xcodebuild(1) commands",
+		"(may be repeated or comma-separated)").Require(BuildSetting))
 
 	env = append(env, NewVar("target-app-config", "c", "proj_config", String,
 		// "Debug",
@@ -58,14 +75,22 @@ func DefaultEnv() Env {
 	env = append(env, NewVar("target-app-bundle", "a", "bundled_app", String,
 		// "com.NorthropGrumman.FMPS-Calculator.Debug", // set with --debug-config (-g)
 		"com.NorthropGrumman.FMPS-Calculator.App",
-		"Bundle `ID` of the target app"))
+		"Bundle `ID` of the target app").Require(BundleID))
 
+	env = append(env, NewVar("test-driver-scheme", "S", "test_scheme", String,
+		"FMPS Calculator",
+		"Build test driver using `scheme` defined in Xcode project file"))
 	env = append(env, NewVar("test-driver-config", "C", "test_config", String,
 		"Release",
 		"Build test driver using `config` from the selected scheme defined in Xcode project file"))
 	env = append(env, NewVar("test-driver-bundle", "b", "bundled_drv", String,
 		"com.NorthropGrumman.FMPS-Test-Driver.App",
-		"Bundle `ID` of the WebDriverAgent service"))
+		"Bundle `ID` of the WebDriverAgent service").Require(BundleID))
+
+	env = append(env, NewVar("capabilities", "K", "appium_caps", JSON,
+		map[string]any{},
+		"Merge the JSON `object` into the Appium capabilities (appium:options)",
+		"(see also: --cap)").Require(JSONObject))
 
 	env = append(env, NewVar("trace", "G", "trace_agent", Bool,
 		false,
@@ -79,34 +104,83 @@ func DefaultEnv() Env {
 // according to the policy given by command-line flags --orphan and --zero.
 func (e Env) Override(orphan, zero bool) Env {
 	for i, v := range e {
+		val, inherit := os.LookupEnv(v.Ident)
 		if v.UserDef {
 			// Never override user-defined values given on the command-line.
+			if inherit {
+				e[i].Ignore(SourceEnv, v.Ident, val, "")
+			}
 			continue
 		}
-		if zero {
+		if zero && v.Source == SourceDefault {
 			// Zero will remove all default values.
 			e[i].Zero = true
 			e[i].Value = nil
+			e[i].Revoke("removed by --zero")
 		}
 		if orphan {
 			// Orphan will prevent environment inheritance.
 			e[i].Orphan = true
 			e[i].EnvValue = nil
-		} else {
-			if val, ok := os.LookupEnv(v.Ident); ok {
-				if err := e[i].Set(val); err != nil {
-					fmt.Fprintf(
-						os.Stderr,
-						"warning: cannot inherit %q from env as flag %q: %v\n",
-						v.Ident, v.Flag, err,
-					)
-				}
+			if inherit {
+				e[i].Ignore(SourceEnv, v.Ident, val, "not inherited with --orphan")
+			}
+		} else if inherit {
+			e[i].Reset()
+			if err := e[i].Set(val); err != nil {
+				fmt.Fprintf(
+					os.Stderr,
+					"warning: cannot inherit %q from env as flag %q: %v\n",
+					v.Ident, v.Flag, err,
+				)
+				e[i].Ignore(SourceEnv, v.Ident, val, "cannot inherit: "+err.Error())
+			} else {
+				e[i].Define(SourceEnv, v.Ident)
 			}
 		}
 	}
 	return e
 }
 
+// Load applies the statements parsed from a config.env file to the
+// configuration environment, marking each variable with the given source.
+// Variables defined on the command-line are never modified.
+//
+// Statements assigning unknown identifiers are ignored.
+func (e Env) Load(asg []Assign, src Source, origin string) error {
+	for _, a := range asg {
+		v, ok := e.Get(func(v *Var) bool { return v.Ident == a.Ident })
+		if !ok {
+			continue
+		}
+		loc := fmt.Sprintf("%s:%d", origin, a.Line)
+		if v.UserDef {
+			v.Ignore(src, loc, a.Value, "")
+			continue
+		}
+		v.Reset()
+		v.Zero = false // a value given explicitly is never removed by --zero
+		if a.Unset {
+			v.Value = nil
+		} else if err := v.Set(a.Value); err != nil {
+			return fmt.Errorf("%w: %s:%d: %s=%q: %w",
+				status.ErrInvalidValue, origin, a.Line, a.Ident, a.Value, err)
+		}
+		v.Define(src, loc)
+	}
+	return nil
+}
+
+// LoadFile parses the config.env file at path and applies it to the
+// configuration environment (see Load).
+func (e Env) LoadFile(path string, src Source) error {
+	asg, err := ParseFile(path)
+	if err != nil {
+		return err
+	}
+	return e.Load(asg, src, path)
+}
+
 func (e Env) Get(want func(*Var) bool) (*Var, bool) {
 	for i := range e {
 		if want(e[i]) {
@@ -116,7 +190,18 @@ func (e Env) Get(want func(*Var) bool) (*Var, bool) {
 	return nil, false
 }
 
-func (e Env) Usage(program, version string, flag ...*Var) func() {
+// Lookup returns the variable with the given ident.
+func (e Env) Lookup(ident string) (*Var, bool) {
+	return e.Get(func(v *Var) bool { return v.Ident == ident })
+}
+
+// Command describes a subcommand listed in the usage output.
+type Command struct {
+	Name  string
+	Brief string
+}
+
+func (e Env) Usage(program, version, synopsis string, cmds []Command, flag ...*Var) func() {
 	return func() {
 		ctrlText := []string{
 			fmt.Sprintf("The following flags control how %s itself operates.", program),
@@ -138,7 +223,18 @@ func (e Env) Usage(program, version string, flag ...*Var) func() {
 		fmt.Println()
 		fmt.Println("USAGE")
 		fmt.Println()
-		fmt.Println(indent.String(program+" [flags]", lalign))
+		fmt.Println(indent.String(synopsis, lalign))
+		if len(cmds) > 0 {
+			fmt.Println()
+			fmt.Println("COMMANDS")
+			fmt.Println()
+			for _, c := range cmds {
+				fmt.Println(commandUsage(c))
+			}
+		}
+		if len(flag) == 0 && len(e) == 0 {
+			return
+		}
 		fmt.Println()
 		fmt.Println("FLAGS")
 		fmt.Println()
@@ -150,6 +246,9 @@ func (e Env) Usage(program, version string, flag ...*Var) func() {
 			}
 			fmt.Println(v.Usage())
 		}
+		if len(e) == 0 {
+			return
+		}
 		fmt.Println()
 		fmt.Println(format(servText...))
 		fmt.Println()
@@ -161,3 +260,14 @@ func (e Env) Usage(program, version string, flag ...*Var) func() {
 		}
 	}
 }
+
+func commandUsage(c Command) string {
+	var buf strings.Builder
+	for range padlen {
+		buf.WriteRune(' ')
+	}
+	buf.WriteString(c.Name)
+	var v Var
+	buf.Write(v.connector(int(collen)-utf8.RuneCountInString(buf.String()), c.Brief))
+	return string(wrap(maxlen, []byte(buf.String())))
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Format identifies the syntax in which the configuration environment is
+// written (see EnvWriter).
+type Format int
+
+const (
+	FormatPOSIX   Format = iota // sh(1) export and unset statements
+	FormatFish                  // fish(1) set statements
+	FormatDotenv                // docker-style .env file
+	FormatLaunchd               // launchd.plist(5) EnvironmentVariables dict
+	FormatJSON                  // JSON object
+)
+
+// Formats lists the names of all formats.
+var Formats = []string{"posix", "fish", "dotenv", "launchd", "json"} //nolint:gochecknoglobals
+
+func (f Format) String() string {
+	if f >= 0 && int(f) < len(Formats) {
+		return Formats[f]
+	}
+	return ""
+}
+
+func ParseFormat(s string) (Format, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range Formats {
+		if s == name {
+			return Format(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: --format=%q (expected one of %s)",
+		status.ErrInvalidValue, s, strings.Join(Formats, ", "))
+}
+
+// Writer returns the EnvWriter of f.
+func (f Format) Writer(quote rune) EnvWriter {
+	switch f {
+	case FormatPOSIX:
+		return posixWriter{quote: quote}
+	case FormatFish:
+		return fishWriter{}
+	case FormatDotenv:
+		return dotenvWriter{}
+	case FormatLaunchd:
+		return launchdWriter{}
+	case FormatJSON:
+		return jsonWriter{}
+	}
+	return nil
+}
+
+// Entry is a single variable of the configuration environment.
+type Entry struct {
+	Ident   string
+	Value   string
+	Comment []string
+	Unset   bool // the variable is removed from the environment
+	Literal bool // Value need not be quoted (a number, boolean or duration)
+	Subst   bool // Value is a command substitution, e.g., "$( xcrun … )"
+}
+
+// EnvWriter writes the configuration environment in the syntax of a Format.
+type EnvWriter interface {
+	// Exec reports whether the syntax can express command substitutions.
+	// Otherwise, they are expanded before the entries are written.
+	Exec() bool
+	// Comments reports whether the syntax has "#" comments.
+	Comments() bool
+	// WriteEnv writes all of the entries.
+	WriteEnv(out io.Writer, entries []Entry) error
+}
+
+// Entries returns the variables of m as entries for an EnvWriter.
+// If exec is false, command substitutions are expanded, and an error is
+// returned if any of them fails. Command substitutions that are not allowed
+// (see AllowExec) are never executed; they are written as literal strings.
+func (m *Model) Entries(exec bool) ([]Entry, error) {
+	entries := make([]Entry, 0, len(m.Env))
+	for _, v := range m.Env {
+		e := Entry{Ident: v.Ident, Value: v.String(), Comment: v.Comment}
+		trim := strings.TrimSpace(e.Value)
+		switch {
+		case !v.UserDef && e.Value == "":
+			e.Unset = true
+		case v.VType == Int || v.VType == Float || v.VType == Bool || v.VType == Duration:
+			e.Value, e.Literal = trim, true
+		case !IsCommandSubst(trim) || !m.execAllowed(v, trim):
+		case exec:
+			e.Value, e.Subst = trim, true
+		default:
+			val, err := ExpandCommandSubst(trim)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", v.Ident, err)
+			}
+			e.Value = val
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// writeEntries writes each entry with the given func, preceded by its
+// comments, separating entries with a blank line.
+func writeEntries(out io.Writer, entries []Entry, write func(Entry) string) error {
+	var str strings.Builder
+	for i, e := range entries {
+		if i > 0 {
+			str.WriteRune('\n')
+		}
+		for _, c := range e.Comment {
+			str.WriteString("# ")
+			str.WriteString(c)
+			str.WriteRune('\n')
+		}
+		str.WriteString(write(e))
+		str.WriteRune('\n')
+	}
+	_, err := io.WriteString(out, str.String())
+	return err
+}
+
+type posixWriter struct{ quote rune }
+
+func (posixWriter) Exec() bool     { return true }
+func (posixWriter) Comments() bool { return true }
+
+func (w posixWriter) WriteEnv(out io.Writer, entries []Entry) error {
+	return writeEntries(out, entries, func(e Entry) string {
+		switch {
+		case e.Unset:
+			return "unset -v " + e.Ident
+		case e.Literal, e.Subst:
+			return "export " + e.Ident + "=" + e.Value // Don't quote
+		}
+		// Quote everything else, and retain untrimmed values.
+		return "export " + e.Ident + "=" + QuotePOSIX(e.Value, w.quote)
+	})
+}
+
+type fishWriter struct{}
+
+func (fishWriter) Exec() bool     { return true }
+func (fishWriter) Comments() bool { return true }
+
+func (fishWriter) WriteEnv(out io.Writer, entries []Entry) error {
+	quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return writeEntries(out, entries, func(e Entry) string {
+		switch {
+		case e.Unset:
+			return "set -e " + e.Ident
+		case e.Literal:
+			return "set -gx " + e.Ident + " " + e.Value
+		case e.Subst:
+			// fish(1) substitutes commands in parentheses, without "$".
+			cmd := strings.TrimSpace(e.Value)
+			cmd = strings.TrimSpace(cmd[2 : len(cmd)-1])
+			return "set -gx " + e.Ident + " (" + cmd + ")"
+		}
+		return "set -gx " + e.Ident + " '" + quote.Replace(e.Value) + "'"
+	})
+}
+
+type dotenvWriter struct{}
+
+func (dotenvWriter) Exec() bool     { return false }
+func (dotenvWriter) Comments() bool { return true }
+
+// WriteEnv writes each value in single quotes, which are taken literally,
+// unless it contains a single quote or newline. Such values are written in
+// double quotes with escapes instead. Unset variables are written as
+// comments, since the syntax cannot remove a variable.
+func (dotenvWriter) WriteEnv(out io.Writer, entries []Entry) error {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, `$`, `$$`)
+	return writeEntries(out, entries, func(e Entry) string {
+		switch {
+		case e.Unset:
+			return "# " + e.Ident + " is unset"
+		case e.Literal:
+			return e.Ident + "=" + e.Value
+		case strings.ContainsAny(e.Value, "'\n"):
+			return e.Ident + `="` + quote.Replace(e.Value) + `"`
+		}
+		return e.Ident + "='" + e.Value + "'"
+	})
+}
+
+type launchdWriter struct{}
+
+func (launchdWriter) Exec() bool     { return false }
+func (launchdWriter) Comments() bool { return false }
+
+// WriteEnv writes the EnvironmentVariables key and dict of a launchd.plist(5),
+// for pasting into a launch agent. Unset variables are omitted.
+func (launchdWriter) WriteEnv(out io.Writer, entries []Entry) error {
+	var str strings.Builder
+	escape := func(s string) string {
+		var b strings.Builder
+		_ = xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	str.WriteString("<key>EnvironmentVariables</key>\n<dict>\n")
+	for _, e := range entries {
+		if e.Unset {
+			continue
+		}
+		str.WriteString("\t<key>" + escape(e.Ident) + "</key>\n")
+		str.WriteString("\t<string>" + escape(e.Value) + "</string>\n")
+	}
+	str.WriteString("</dict>\n")
+	_, err := io.WriteString(out, str.String())
+	return err
+}
+
+type jsonWriter struct{}
+
+func (jsonWriter) Exec() bool     { return false }
+func (jsonWriter) Comments() bool { return false }
+
+// WriteEnv writes a JSON object mapping each ident to its value,
+// or to null if it is unset.
+func (jsonWriter) WriteEnv(out io.Writer, entries []Entry) error {
+	var buf strings.Builder
+	buf.WriteString("{")
+	for i, e := range entries {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, _ := json.Marshal(e.Ident)
+		val := []byte("null")
+		if !e.Unset {
+			val, _ = json.Marshal(e.Value)
+		}
+		buf.WriteString("\n  " + string(key) + ": " + string(val))
+	}
+	buf.WriteString("\n}\n")
+	_, err := io.WriteString(out, buf.String())
+	return err
+}
@@ -0,0 +1,273 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+func TestQuotePOSIX(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		single string // quoted with '
+		double string // quoted with "
+	}{
+		{"plain", "FMPS Calculator", `'FMPS Calculator'`, `"FMPS Calculator"`},
+		{"empty", "", `''`, `""`},
+		{"single quote", "it's", `'it'\''s'`, `"it's"`},
+		{"double quote", `say "hi"`, `'say "hi"'`, `"say \"hi\""`},
+		{"dollar", "$HOME/${USER}", `'$HOME/${USER}'`, `"\$HOME/\${USER}"`},
+		{"backslash", `C:\path\n`, `'C:\path\n'`, `"C:\\path\\n"`},
+		{"backquote", "`id`", "'`id`'", "\"\\`id\\`\""},
+		{"command substitution", "$( id -un )", `'$( id -un )'`, `"\$( id -un )"`},
+		{"newline", "one\ntwo", "'one\ntwo'", "\"one\ntwo\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for quote, want := range map[rune]string{'\'': tt.single, '"': tt.double} {
+				got := QuotePOSIX(tt.s, quote)
+				if got != want {
+					t.Errorf("QuotePOSIX(%q, %c) = %s, want %s", tt.s, quote, got, want)
+				}
+				// The shell expands the quoted string to exactly s.
+				out, err := exec.Command("/bin/sh", "-c", "printf '%s' "+got).Output()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(out) != tt.s {
+					t.Errorf("sh expanded %s to %q, want %q", got, out, tt.s)
+				}
+			}
+		})
+	}
+}
+
+// newModel returns the default configuration with ident set to value by the
+// user, as if given on the command-line.
+func newModel(t *testing.T, allowExec bool, ident, value string) *Model {
+	t.Helper()
+	m := new(Model)
+	if err := m.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	m.AllowExec = allowExec
+	if ident != "" {
+		v, ok := m.Env.Lookup(ident)
+		if !ok {
+			t.Fatalf("undefined %q", ident)
+		}
+		if err := v.Set(value); err != nil {
+			t.Fatal(err)
+		}
+		v.UserDef = true
+		v.Define(SourceFlag, "--"+v.Flag)
+	}
+	return m
+}
+
+// withoutXcrun replaces the default sdk_version, which runs xcrun(1), unless
+// it was set by the user, so that the configuration can be expanded on hosts
+// other than macOS.
+func withoutXcrun(t *testing.T, m *Model) {
+	t.Helper()
+	if v, _ := m.Env.Lookup("sdk_version"); !v.UserDef {
+		if err := v.Set("17.4"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func entry(t *testing.T, entries []Entry, ident string) Entry {
+	t.Helper()
+	for _, e := range entries {
+		if e.Ident == ident {
+			return e
+		}
+	}
+	t.Fatalf("no entry %q", ident)
+	return Entry{}
+}
+
+func TestCommandSubstAllowed(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "executed")
+	subst := "$( touch " + marker + " && echo ran )"
+	tests := []struct {
+		name      string
+		allowExec bool
+		ident     string
+		value     string
+		check     string // ident of the entry checked
+		allowed   bool
+	}{
+		{"default opted in", false, "", "", "sdk_version", true},
+		{"user value denied", false, "proj_scheme", subst, "proj_scheme", false},
+		{"user value allowed", true, "proj_scheme", subst, "proj_scheme", true},
+		{"user value replacing default denied", false, "sdk_version", subst, "sdk_version", false},
+		{"user value replacing default allowed", true, "sdk_version", subst, "sdk_version", true},
+		{"default not opted in", false, "", "", "ios_version", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newModel(t, tt.allowExec, tt.ident, tt.value)
+			entries, err := m.Entries(true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := entry(t, entries, tt.check)
+			if IsCommandSubst(e.Value) && e.Subst != tt.allowed {
+				t.Errorf("%s: Subst = %v, want %v", tt.check, e.Subst, tt.allowed)
+			}
+			denied := errors.Is(m.Validate(), status.ErrExecDenied)
+			if wantDenied := tt.ident != "" && !tt.allowed; denied != wantDenied {
+				t.Errorf("Validate() denied = %v, want %v", denied, wantDenied)
+			}
+			if tt.ident == "" || tt.allowed {
+				return
+			}
+			// A denied substitution is written quoted, and is never executed,
+			// even by formats that expand substitutions.
+			var out strings.Builder
+			if err = m.Write(&out); err != nil {
+				t.Fatal(err)
+			}
+			want := "export " + tt.check + "=" + QuotePOSIX(tt.value, m.EnvQuote)
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("Write() does not contain %s:\n%s", want, out.String())
+			}
+			withoutXcrun(t, m)
+			if entries, err = m.Entries(false); err != nil {
+				t.Fatal(err)
+			}
+			if e = entry(t, entries, tt.check); e.Value != tt.value {
+				t.Errorf("%s = %q, want %q", tt.check, e.Value, tt.value)
+			}
+			if _, err = os.Stat(marker); err == nil {
+				t.Error("denied command substitution was executed")
+			}
+		})
+	}
+}
+
+func TestCommandSubstExpanded(t *testing.T) {
+	m := newModel(t, true, "proj_scheme", "$( printf '%s' \"it's\" )")
+	withoutXcrun(t, m)
+	entries, err := m.Entries(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := entry(t, entries, "proj_scheme"); e.Subst || e.Value != "it's" {
+		t.Errorf("proj_scheme = %+v, want expanded value %q", e, "it's")
+	}
+	m = newModel(t, true, "proj_scheme", "$( false )")
+	withoutXcrun(t, m)
+	if _, err = m.Entries(false); !errors.Is(err, status.ErrCommandSubst) {
+		t.Errorf("Entries(false) = %v, want %v", err, status.ErrCommandSubst)
+	}
+}
+
+func TestWriteEnv(t *testing.T) {
+	entries := []Entry{
+		{Ident: "plain", Value: "FMPS Calculator", Comment: []string{"the scheme"}},
+		{Ident: "quote", Value: `it's "$HOME" \n`},
+		{Ident: "lines", Value: "one\ntwo"},
+		{Ident: "port", Value: "4723", Literal: true},
+		{Ident: "sdk", Value: "$( xcrun --show-sdk-version )", Subst: true},
+		{Ident: "gone", Unset: true},
+	}
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{FormatPOSIX, "# the scheme\n" +
+			"export plain='FMPS Calculator'\n\n" +
+			`export quote='it'\''s "$HOME" \n'` + "\n\n" +
+			"export lines='one\ntwo'\n\n" +
+			"export port=4723\n\n" +
+			"export sdk=$( xcrun --show-sdk-version )\n\n" +
+			"unset -v gone\n"},
+		{FormatFish, "# the scheme\n" +
+			"set -gx plain 'FMPS Calculator'\n\n" +
+			`set -gx quote 'it\'s "$HOME" \\n'` + "\n\n" +
+			"set -gx lines 'one\ntwo'\n\n" +
+			"set -gx port 4723\n\n" +
+			"set -gx sdk (xcrun --show-sdk-version)\n\n" +
+			"set -e gone\n"},
+		{FormatDotenv, "# the scheme\n" +
+			"plain='FMPS Calculator'\n\n" +
+			`quote="it's \"$$HOME\" \\n"` + "\n\n" +
+			`lines="one\ntwo"` + "\n\n" +
+			"port=4723\n\n" +
+			"sdk='$( xcrun --show-sdk-version )'\n\n" +
+			"# gone is unset\n"},
+		{FormatLaunchd, "<key>EnvironmentVariables</key>\n<dict>\n" +
+			"\t<key>plain</key>\n\t<string>FMPS Calculator</string>\n" +
+			"\t<key>quote</key>\n\t<string>it&#39;s &#34;$HOME&#34; \\n</string>\n" +
+			"\t<key>lines</key>\n\t<string>one&#xA;two</string>\n" +
+			"\t<key>port</key>\n\t<string>4723</string>\n" +
+			"\t<key>sdk</key>\n\t<string>$( xcrun --show-sdk-version )</string>\n" +
+			"</dict>\n"},
+		{FormatJSON, "{\n" +
+			`  "plain": "FMPS Calculator",` + "\n" +
+			`  "quote": "it's \"$HOME\" \\n",` + "\n" +
+			`  "lines": "one\ntwo",` + "\n" +
+			`  "port": "4723",` + "\n" +
+			`  "sdk": "$( xcrun --show-sdk-version )",` + "\n" +
+			`  "gone": null` + "\n" +
+			"}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			var out strings.Builder
+			if err := tt.format.Writer('\'').WriteEnv(&out, entries); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("WriteEnv:\ngot\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteEnvPOSIX sources the POSIX format and checks the values the shell
+// assigns, including a command substitution that is executed.
+func TestWriteEnvPOSIX(t *testing.T) {
+	entries := []Entry{
+		{Ident: "quote", Value: `it's "$HOME" \n $( id )`},
+		{Ident: "lines", Value: "one\ntwo"},
+		{Ident: "sdk", Value: "$( printf 17.4 )", Subst: true},
+		{Ident: "gone", Unset: true},
+	}
+	for _, quote := range []rune{'\'', '"'} {
+		var out strings.Builder
+		if err := FormatPOSIX.Writer(quote).WriteEnv(&out, entries); err != nil {
+			t.Fatal(err)
+		}
+		script := "gone=x\n" + out.String() +
+			`printf '%s|%s|%s|%s' "${quote}" "${lines}" "${sdk}" "${gone-unset}"`
+		got, err := exec.Command("/bin/sh", "-c", script).Output()
+		if err != nil {
+			t.Fatalf("%v:\n%s", err, script)
+		}
+		if want := `it's "$HOME" \n $( id )|one` + "\ntwo|17.4|unset"; string(got) != want {
+			t.Errorf("quote %c: sh assigned %q, want %q", quote, got, want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for i, name := range Formats {
+		f, err := ParseFormat(" " + strings.ToUpper(name) + " ")
+		if err != nil || f != Format(i) {
+			t.Errorf("ParseFormat(%q) = %v, %v; want %v", name, f, err, Format(i))
+		}
+	}
+	if _, err := ParseFormat("csh"); !errors.Is(err, status.ErrInvalidValue) {
+		t.Errorf("ParseFormat(csh) = %v, want %v", err, status.ErrInvalidValue)
+	}
+}
@@ -7,12 +7,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"iter"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ardnew/appium-agent/status"
 	"github.com/muesli/reflow/wordwrap"
@@ -37,6 +41,10 @@ func LookupSource() (string, error) {
 	return path, nil
 }
 
+// LookupBackup returns the directory containing the backups of source.
+//
+// For compatibility with configurations that define a single backup file,
+// a path naming an existing regular file selects its parent directory.
 func LookupBackup(source string) (string, error) {
 	if source == "" {
 		return "", fmt.Errorf(
@@ -48,15 +56,85 @@ func LookupBackup(source string) (string, error) {
 		return "", fmt.Errorf("%w: %s=%q", os.ErrNotExist, BackupIdent, path)
 	}
 	info, err := os.Stat(path)
-	if errors.Is(err, os.ErrNotExist) || info.IsDir() {
-		if err := os.MkdirAll(path, 0o755); err != nil { //nolint:gomnd,mnd
-			return "", fmt.Errorf("%w: %s=%q", status.ErrInvalidBackup, BackupIdent, path)
-		}
-		return filepath.Join(path, filepath.Base(source)), nil
+	if err == nil && !info.IsDir() {
+		return filepath.Dir(path), nil
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil { //nolint:gomnd,mnd
+		return "", fmt.Errorf("%w: %s=%q: %w", status.ErrInvalidBackup, BackupIdent, path, err)
 	}
 	return path, nil
 }
 
+// BackupRetention returns the number of backups to keep.
+func BackupRetention() int {
+	if s, ok := os.LookupEnv(BackupKeepIdent); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil && n > 0 {
+			return n
+		}
+	}
+	return DefaultBackupKeep
+}
+
+// LookupProfiles returns the directory of named configuration profiles,
+// located next to the installed configuration.
+func LookupProfiles(source string) (string, error) {
+	if source == "" {
+		return "", fmt.Errorf(
+			"%w: no source path defined for profiles: %s", os.ErrNotExist, SourceIdent,
+		)
+	}
+	return filepath.Join(filepath.Dir(source), ProfileDir), nil
+}
+
+// LookupProfile returns the path of the named configuration profile.
+func LookupProfile(source, name string) (string, error) {
+	if !IsProfileName(name) {
+		return "", fmt.Errorf("%w: %q", status.ErrInvalidProfile, name)
+	}
+	dir, err := LookupProfiles(source)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+ProfileExt), nil
+}
+
+// Profiles returns the names of all configuration profiles, sorted.
+func Profiles(source string) ([]string, error) {
+	dir, err := LookupProfiles(source)
+	if err != nil {
+		return nil, err
+	}
+	ent, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrReadFile, dir, err)
+	}
+	var names []string
+	for _, e := range ent {
+		if name, ok := strings.CutSuffix(e.Name(), ProfileExt); ok && e.Type().IsRegular() {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// IsProfileName reports whether name can be used as a profile name.
+// Names are restricted so that they cannot escape the profiles directory.
+func IsProfileName(name string) bool {
+	if name == "" || name[0] == '.' {
+		return false
+	}
+	for _, c := range name {
+		if !strings.ContainsRune("-_.", c) &&
+			(c < '0' || c > '9') && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
 func LookupTempConfig(base, name string) (string, error) {
 	path, ok := os.LookupEnv(TmpCfgIdent)
 	if path == "" || !ok {
@@ -86,19 +164,76 @@ func LookupTempConfig(base, name string) (string, error) {
 	return "", fmt.Errorf("%w: invalid path: %q", status.ErrInvalidConfig, path)
 }
 
-func Backup(source, backup string) error {
-	// Don't attempt to backup or return an error
-	// if only one path (or neither) is provided.
-	if source != "" && backup != "" {
-		if err := os.Rename(source, backup); err != nil {
-			return fmt.Errorf(
-				"%w: backup: %q -> %q: %w", status.ErrWriteFile, source, backup, err,
-			)
+// WriteAtomic replaces the file at path with the content written by write.
+//
+// The content is written to a temporary file in the same directory,
+// flushed to stable storage, and then renamed over path,
+// so readers observe either the previous or the new content, never a mix.
+func WriteAtomic(path string, perm os.FileMode, write func(io.Writer) error) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd,mnd
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, path, err)
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".*")
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path, err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
 		}
+	}()
+	if err = write(tmp); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, tmp.Name(), err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, tmp.Name(), err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, tmp.Name(), err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%w: %q -> %q: %w", status.ErrWriteFile, tmp.Name(), path, err)
 	}
 	return nil
 }
 
+// IsCommandSubst reports whether s is a shell command substitution "$( … )".
+func IsCommandSubst(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "$(") && strings.HasSuffix(s, ")")
+}
+
+// ExpandCommandSubst returns the output of the command substitution s,
+// as the shell would when sourcing the configuration.
+func ExpandCommandSubst(s string) (string, error) {
+	// The assignment fails with the status of the substituted command.
+	out, err := exec.Command("/bin/sh", "-c", "v="+s+` && printf '%s' "${v}"`).Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", status.ErrCommandSubst, s, err)
+	}
+	return string(out), nil
+}
+
+// QuotePOSIX returns s enclosed in quote, either ' or ", escaping every
+// character that a POSIX shell would otherwise interpret, so that the shell
+// expands the result to exactly s.
+func QuotePOSIX(s string, quote rune) string {
+	if quote == '"' {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(s) + `"`
+	}
+	// A single quote cannot occur within single quotes, so end the quoted
+	// string, append an escaped single quote, and begin another.
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 func Filter[T any](seq iter.Seq[T], keep func(T) bool) []T {
 	var defined []T
 	for v := range seq {
@@ -124,7 +259,7 @@ func encode[T any](v *Var, fn func(T) string) (s string) {
 	if l, ok := sel.([]T); ok {
 		for i, n := range l {
 			if i > 0 {
-				s += ","
+				s += ListSep
 			}
 			s += fn(n)
 		}
@@ -133,13 +268,19 @@ func encode[T any](v *Var, fn func(T) string) (s string) {
 }
 
 func decode[T any](v *Var, s string, fn func(string) (T, error)) error {
+	if v.Aggr {
+		return decodeList(v, s, fn)
+	}
 	// Always record both the given value (r) and the envionment value (e).
 	//
 	// Which one is used (via Var.String()) depends on the UserDef flag
 	// (which is set iff the corresponding command-line flag was provided).
 	var r, e T
 	if !v.Zero {
-		r, _ = fn(s)
+		var err error
+		if r, err = fn(s); err != nil {
+			return err
+		}
 	}
 	if !v.Orphan {
 		if env, ok := os.LookupEnv(v.Ident); ok {
@@ -148,19 +289,70 @@ func decode[T any](v *Var, s string, fn func(string) (T, error)) error {
 			}
 		}
 	}
-	if !v.Aggr {
-		v.Value = r
-		v.EnvValue = e
-	} else if l, ok := v.Value.([]T); ok {
-		v.Value = append(l, r) //nolint:gocritic
-		v.EnvValue = append(l, e)
-	} else {
-		v.Value = []T{r}
-		v.EnvValue = []T{e}
+	v.Value = r
+	v.EnvValue = e
+	return nil
+}
+
+// decodeList decodes the comma-separated items of s into an aggregate Var.
+//
+// The first call replaces the value of v; subsequent calls (e.g., repeated
+// command-line flags) append to it until v.Reset is called. The environment
+// value is always decoded on its own, never appended to the given value.
+func decodeList[T any](v *Var, s string, fn func(string) (T, error)) error {
+	var r, e []T
+	if !v.Zero {
+		for _, item := range SplitList(s) {
+			x, err := fn(item)
+			if err != nil {
+				return err
+			}
+			r = append(r, x)
+		}
 	}
+	if !v.Orphan {
+		if env, ok := os.LookupEnv(v.Ident); ok {
+			for _, item := range SplitList(env) {
+				if x, err := fn(item); err == nil {
+					e = append(e, x)
+				}
+			}
+		}
+	}
+	if l, ok := v.Value.([]T); ok && v.accum {
+		r = append(slices.Clip(l), r...)
+	}
+	v.Value, v.EnvValue, v.accum = r, e, true
 	return nil
 }
 
+// ParseCapability returns the name and value of a capability given as
+// "name=value". The value is inferred from its JSON syntax (a boolean, number,
+// null, array, object or quoted string), otherwise it is the literal string.
+func ParseCapability(s string) (string, any, error) {
+	name, raw, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", nil, fmt.Errorf("%w: expected name=value, got %q", status.ErrInvalidValue, s)
+	}
+	var val any
+	if err := json.Unmarshal([]byte(raw), &val); err != nil {
+		return name, raw, nil
+	}
+	return name, val, nil
+}
+
+// SplitList returns the trimmed, non-empty, comma-separated items of s.
+func SplitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ListSep) {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func encodeFloat(f float64) string {
 	return strconv.FormatFloat(f, 'f', -1, 64)
 }
@@ -183,6 +375,65 @@ func decodeFloat(s string) (float64, error) {
 	return strconv.ParseFloat(s, 64)
 }
 
+func decodeDuration(s string) (time.Duration, error) {
+	return time.ParseDuration(strings.TrimSpace(s))
+}
+
+// verbatim returns a decoder that passes blank values and command
+// substitutions through unchanged, since those are only known once the
+// configuration is sourced by the shell, and otherwise applies fn.
+func verbatim(fn func(string) (string, error)) func(string) (string, error) {
+	return func(s string) (string, error) {
+		if t := strings.TrimSpace(s); t == "" || IsCommandSubst(t) {
+			return s, nil
+		}
+		return fn(s)
+	}
+}
+
+// ExpandPath returns the absolute, cleaned form of path s, with a leading "~"
+// replaced by the user's home directory.
+func ExpandPath(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "~" || strings.HasPrefix(s, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		s = filepath.Join(home, s[1:])
+	}
+	return filepath.Abs(s)
+}
+
+func decodeEnum(v *Var) func(string) (string, error) {
+	return func(s string) (string, error) {
+		s = strings.TrimSpace(s)
+		if len(v.Choices) > 0 && !slices.Contains(v.Choices, s) {
+			return "", fmt.Errorf("%q is not one of %s", s, strings.Join(v.Choices, ", "))
+		}
+		return s, nil
+	}
+}
+
+func decodeURL(s string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return "", fmt.Errorf("expected an absolute URL, e.g., http://host:port, got %q", s)
+	}
+	return u.String(), nil
+}
+
+func decodeVersion(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if err := DottedVersion(s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
 func decodeJSON(v *Var) func(string) (any, error) {
 	return func(s string) (any, error) {
 		if err := json.Unmarshal([]byte(s), &v.Value); err != nil {
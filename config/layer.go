@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ardnew/appium-agent/command"
+)
+
+// Configuration layers are config.env files that are applied, in order of
+// increasing precedence, before any --config-file or profile:
+//
+//  1. SystemLayer: shared by all users of the installation prefix
+//  2. UserLayer: per user, in $XDG_CONFIG_HOME
+//  3. FindProjectLayer: per app, next to its source code
+//
+// Like other configuration files, layers never override parameters given on
+// the command-line, and are overridden by the environment.
+
+// SystemLayer returns the path of the system configuration layer in the
+// installation prefix root.
+func SystemLayer(root string) string {
+	return filepath.Join(filepath.Dir(command.AppiumdConfigJSON(root)), SystemLayerFile)
+}
+
+// UserLayer returns the path of the user configuration layer in
+// $XDG_CONFIG_HOME, or in ~/.config if it is undefined or relative.
+func UserLayer() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, UserLayerDir, UserLayerFile), nil
+}
+
+// FindProjectLayer returns the path of the project configuration layer
+// nearest to start, i.e., the first ProjectLayerFile found in start or any
+// of its parent directories.
+func FindProjectLayer(start string) (string, bool) {
+	if start == "" {
+		return "", false
+	}
+	dir := filepath.Clean(start)
+	for {
+		path := filepath.Join(dir, ProjectLayerFile)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// LoadLayer applies the configuration layer at path, if it exists, marking
+// each variable with the given source (see LoadFile).
+// It returns true if the layer exists.
+func (e Env) LoadLayer(path string, src Source) (bool, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return true, e.LoadFile(path, src)
+}
+
+// Layer is a configuration layer applied by Model.LoadLayers.
+type Layer struct {
+	Source Source // SourceSystem, SourceUser or SourceProject
+	Path   string
+}
+
+// LoadLayers applies the system, user and project configuration layers, in
+// that order, to the parameters not given on the command-line. The system
+// layer is found in the installation prefix root, and the project layer from
+// target-app-source, which may itself be defined by a lower layer.
+//
+// It returns the layers that exist, and whether any of them changed the value
+// of a parameter.
+func (m *Model) LoadLayers(root string) ([]Layer, bool, error) {
+	prior := make(map[string]string, len(m.Env))
+	for _, v := range m.Env {
+		prior[v.Ident] = v.String()
+	}
+	var loaded []Layer
+	load := func(l Layer) error {
+		ok, err := m.Env.LoadLayer(l.Path, l.Source)
+		if err != nil {
+			return fmt.Errorf("%s layer: %w", l.Source, err)
+		}
+		if ok {
+			loaded = append(loaded, l)
+		}
+		return nil
+	}
+	layers := []Layer{{SourceSystem, SystemLayer(root)}}
+	if path, err := UserLayer(); err == nil {
+		layers = append(layers, Layer{SourceUser, path})
+	}
+	for _, l := range layers {
+		if err := load(l); err != nil {
+			return nil, false, err
+		}
+	}
+	if path, ok := FindProjectLayer(m.projectSource()); ok {
+		if err := load(Layer{SourceProject, path}); err != nil {
+			return nil, false, err
+		}
+	}
+	changed := false
+	for _, v := range m.Env {
+		changed = changed || v.String() != prior[v.Ident]
+	}
+	return loaded, changed, nil
+}
+
+// projectSource returns the directory from which the project configuration
+// layer is found: target-app-source as it will be resolved, including any
+// value inherited from the environment.
+func (m *Model) projectSource() string {
+	v, ok := m.Env.Lookup("proj_source")
+	if !ok {
+		return ""
+	}
+	s := v.String()
+	if env, inherit := os.LookupEnv(v.Ident); inherit && !v.UserDef && !m.Orphan {
+		s = env
+	}
+	if s = strings.TrimSpace(s); s == "" || IsCommandSubst(s) {
+		return ""
+	}
+	path, err := ExpandPath(s)
+	if err != nil {
+		return ""
+	}
+	return path
+}
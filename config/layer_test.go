@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeLayer(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "xdg"))
+	t.Setenv("proj_source", "") // restored after the test
+	os.Unsetenv("proj_source")  // found only from the layers
+	user, err := UserLayer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proj := filepath.Join(root, "src", "app")
+	project := filepath.Join(root, "src", ProjectLayerFile) // in a parent
+	system := SystemLayer(root)
+
+	m := new(Model)
+	if err = m.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, changed, lerr := m.LoadLayers(root); lerr != nil || changed {
+		t.Errorf("LoadLayers() without layers = %v, %v; want unchanged", changed, lerr)
+	}
+
+	writeLayer(t, system, "export listen_port=4800 proj_config='Debug' test_config='Debug'\n")
+	writeLayer(t, user, "export listen_port=4801 proj_source='"+proj+"'\n")
+	writeLayer(t, project, "export listen_port=4802\n")
+	if err = os.MkdirAll(proj, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	m = new(Model)
+	if err = m.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	// A parameter given on the command-line is never overridden.
+	v, _ := m.Env.Lookup("test_config")
+	if err = v.Set("Staging"); err != nil {
+		t.Fatal(err)
+	}
+	v.UserDef = true
+	layers, changed, err := m.LoadLayers(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Layer{{SourceSystem, system}, {SourceUser, user}, {SourceProject, project}}
+	if !reflect.DeepEqual(layers, want) {
+		t.Errorf("LoadLayers() = %+v, want %+v", layers, want)
+	}
+	if !changed {
+		t.Error("LoadLayers() changed = false, want true")
+	}
+	for ident, want := range map[string]string{
+		"listen_port": "4802", // project overrides user and system
+		"proj_source": proj,
+		"proj_config": "Debug",
+		"test_config": "Staging",
+	} {
+		if v, _ := m.Env.Lookup(ident); v.String() != want {
+			t.Errorf("%s = %q, want %q", ident, v.String(), want)
+		}
+	}
+	if v, _ := m.Env.Lookup("listen_port"); v.Source != SourceProject {
+		t.Errorf("listen_port source = %v, want %v", v.Source, SourceProject)
+	}
+}
+
+// TestLoadLayersUnchanged checks that layers that only repeat the defaults
+// do not change the configuration.
+func TestLoadLayersUnchanged(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "xdg"))
+	writeLayer(t, SystemLayer(root), "export listen_port=4723\n")
+	m := new(Model)
+	if err := m.Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	layers, changed, err := m.LoadLayers(root)
+	if err != nil || len(layers) != 1 || changed {
+		t.Errorf("LoadLayers() = %+v, %v, %v; want 1 layer, unchanged", layers, changed, err)
+	}
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+const lockExt = ".lock"
+
+// Lock is an advisory lock guarding writes to a configuration file.
+//
+// The lock is held on a separate file (the guarded path plus ".lock"),
+// which records the process holding it so that contention can be reported.
+type Lock struct {
+	path string
+	file *os.File
+}
+
+// Holder describes the process holding a Lock.
+type Holder struct {
+	PID   int
+	User  string
+	SSH   string // client address of the holder's SSH connection, if any
+	Since time.Time
+}
+
+func (h Holder) String() string {
+	s := "pid " + strconv.Itoa(h.PID)
+	if h.User != "" {
+		s += " (user " + h.User
+		if h.SSH != "" {
+			s += " via ssh from " + h.SSH
+		}
+		s += ")"
+	}
+	if !h.Since.IsZero() {
+		s += " since " + h.Since.Format(time.RFC1123)
+	}
+	return s
+}
+
+// AcquireLock acquires the advisory lock guarding path without blocking.
+//
+// If another process holds the lock, the returned error wraps status.ErrLocked
+// and identifies the holder.
+func AcquireLock(path string) (*Lock, error) {
+	return AcquireLockFile(path + lockExt)
+}
+
+// AcquireLockFile is like AcquireLock, but holds the lock on the lock file at
+// path, e.g., in a runtime directory, rather than next to the guarded file.
+func AcquireLockFile(path string) (*Lock, error) {
+	l := &Lock{path: path}
+	// The directory of the lock file may not exist yet.
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil { //nolint:gomnd,mnd
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrOpenFile, l.path, err)
+	}
+	if err := l.acquire(); err != nil {
+		return nil, err
+	}
+	if err := l.record(); err != nil {
+		l.Release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Release releases the lock. It is safe to call on a nil Lock.
+func (l *Lock) Release() {
+	if l == nil || l.file == nil {
+		return
+	}
+	l.release()
+	l.file = nil
+}
+
+// WriteLocked atomically replaces the file at path (see WriteAtomic)
+// while holding its advisory lock.
+func WriteLocked(path string, perm os.FileMode, write func(io.Writer) error) error {
+	l, err := AcquireLock(path)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return WriteAtomic(path, perm, write)
+}
+
+// WriteLockedFile is like WriteLocked, but holds the lock on the lock file at
+// lock (see AcquireLockFile).
+func WriteLockedFile(lock, path string, perm os.FileMode, write func(io.Writer) error) error {
+	l, err := AcquireLockFile(lock)
+	if err != nil {
+		return err
+	}
+	defer l.Release()
+	return WriteAtomic(path, perm, write)
+}
+
+// record writes the current process's identity into the lock file.
+func (l *Lock) record() error {
+	h := Holder{PID: os.Getpid(), Since: time.Now()}
+	if u, err := user.Current(); err == nil {
+		h.User = u.Username
+	} else {
+		h.User = os.Getenv("USER")
+	}
+	if ssh := strings.Fields(os.Getenv("SSH_CLIENT")); len(ssh) > 0 {
+		h.SSH = ssh[0]
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, l.path, err)
+	}
+	_, err := fmt.Fprintf(l.file, "pid=%d\nuser=%s\nssh=%s\nsince=%s\n",
+		h.PID, h.User, h.SSH, h.Since.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, l.path, err)
+	}
+	return nil
+}
+
+// holder returns the identity recorded in the lock file at path.
+func holder(path string) Holder {
+	var h Holder
+	f, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		key, val, _ := strings.Cut(scan.Text(), "=")
+		switch key {
+		case "pid":
+			h.PID, _ = strconv.Atoi(val)
+		case "user":
+			h.User = val
+		case "ssh":
+			h.SSH = val
+		case "since":
+			h.Since, _ = time.Parse(time.RFC3339, val)
+		}
+	}
+	return h
+}
+
+func errLocked(path string) error {
+	return fmt.Errorf("%w: %q is held by %s", status.ErrLocked, path, holder(path))
+}
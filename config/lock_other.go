@@ -0,0 +1,31 @@
+//go:build !unix
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Without flock(2), the lock file itself is the lock:
+// it exists only while a process holds the lock.
+
+func (l *Lock) acquire() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644) //nolint:gomnd,mnd
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return errLocked(l.path)
+		}
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, l.path, err)
+	}
+	l.file = f
+	return nil
+}
+
+func (l *Lock) release() {
+	_ = l.file.Close()
+	_ = os.Remove(l.path)
+}
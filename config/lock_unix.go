@@ -0,0 +1,36 @@
+//go:build unix
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+func (l *Lock) acquire() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644) //nolint:gomnd,mnd
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, l.path, err)
+	}
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return errLocked(l.path)
+		}
+		return fmt.Errorf("%w: %q: %w", status.ErrLocked, l.path, err)
+	}
+	l.file = f
+	return nil
+}
+
+func (l *Lock) release() {
+	// Clear the holder's identity before unlocking; the file itself remains,
+	// since removing it would race with processes waiting to lock it.
+	_ = l.file.Truncate(0)
+	_ = syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	_ = l.file.Close()
+}
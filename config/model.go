@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -21,6 +22,10 @@ type Model struct {
 	Orphan   bool
 	Zero     bool
 	Debug    bool
+
+	// AllowExec permits command substitutions in any value, rather than
+	// only the defaults that opt in (see Var.ExecDefault).
+	AllowExec bool
 }
 
 func (m *Model) Init(cmd *command.Model) error {
@@ -44,13 +49,59 @@ func (m *Model) ApplyToFlags(visit func(func(*flag.Flag)), apply func(*Var) bool
 	return result
 }
 
+// Validate returns an error wrapping every undefined parameter
+// (aggregate parameters may be empty), every command substitution that is
+// not allowed (see AllowExec),
+// every violated constraint of each parameter, and every violated rule
+// spanning multiple parameters (see DefaultRules).
 func (m *Model) Validate() error {
+	var errs []error
 	for _, val := range m.Env {
-		if strings.TrimSpace(val.String()) == "" {
-			return fmt.Errorf("%w: %q", status.ErrIdentUndef, val.Ident)
+		s := strings.TrimSpace(val.String())
+		if s == "" && !val.Aggr {
+			errs = append(errs, fmt.Errorf("%w: %q", status.ErrIdentUndef, val.Ident))
+			continue
+		}
+		if IsCommandSubst(s) && !m.execAllowed(val, s) {
+			errs = append(errs, execDenied(val, s))
+			continue
 		}
+		errs = append(errs, val.Check()...)
 	}
-	return nil
+	for _, rule := range DefaultRules() {
+		errs = append(errs, rule(m)...)
+	}
+	return errors.Join(errs...)
+}
+
+// Expand returns the trimmed value of the parameter ident. A command
+// substitution is replaced by its output, if it may be executed (see
+// AllowExec); otherwise, an error wrapping status.ErrExecDenied is returned.
+func (m *Model) Expand(ident string) (string, error) {
+	v, ok := m.Env.Lookup(ident)
+	if !ok {
+		return "", fmt.Errorf("%w: %q", status.ErrIdentUndef, ident)
+	}
+	s := strings.TrimSpace(v.String())
+	if !IsCommandSubst(s) {
+		return s, nil
+	}
+	if !m.execAllowed(v, s) {
+		return "", execDenied(v, s)
+	}
+	return ExpandCommandSubst(s)
+}
+
+func execDenied(v *Var, s string) error {
+	from, _ := v.Winner()
+	return fmt.Errorf("%w: --%s=%q from %s (use --allow-exec to run it)",
+		status.ErrExecDenied, v.Flag, s, from)
+}
+
+// execAllowed reports whether the command substitution s may be executed
+// as the value of v.
+func (m *Model) execAllowed(v *Var, s string) bool {
+	return m.AllowExec || v.execDefault(s)
 }
 
 func (m *Model) TargetSimulatorFlagHandler() func(string) error {
@@ -74,54 +125,40 @@ func (m *Model) TargetSimulatorFlagHandler() func(string) error {
 }
 
 func (m *Model) Write(out io.Writer, footer ...string) error {
-	fmt.Fprintln(out, "# ==============================================================================")
-	fmt.Fprintln(out, "#  FSDS Appium Configuration -- DO NOT EDIT")
-	fmt.Fprintln(out, "# ------------------------------------------------------------------------------")
-	fmt.Fprintf(out, "#  Generated on %s with:\n#    %q\n", time.Now().Format(time.RFC1123), os.Args)
-	fmt.Fprintln(out, "# ==============================================================================")
-	fmt.Fprintln(out)
-	fmt.Fprintln(out, m) // <- All of the export statements
-	for _, line := range footer {
-		fmt.Fprint(out, line)
+	return m.WriteFormat(out, FormatPOSIX, footer...)
+}
+
+// WriteFormat writes the configuration in the syntax of format f.
+// The header and footer are written only if the syntax has comments.
+func (m *Model) WriteFormat(out io.Writer, f Format, footer ...string) error {
+	w := f.Writer(m.EnvQuote)
+	entries, err := m.Entries(w.Exec())
+	if err != nil {
+		return err
+	}
+	if w.Comments() {
+		fmt.Fprintln(out, "# ==============================================================================")
+		fmt.Fprintln(out, "#  FSDS Appium Configuration -- DO NOT EDIT")
+		fmt.Fprintln(out, "# ------------------------------------------------------------------------------")
+		fmt.Fprintf(out, "#  Generated on %s with:\n#    %q\n", time.Now().Format(time.RFC1123), os.Args)
+		fmt.Fprintln(out, "# ==============================================================================")
+		fmt.Fprintln(out)
+	}
+	if err = w.WriteEnv(out, entries); err != nil {
+		return err
+	}
+	if w.Comments() {
+		fmt.Fprintln(out)
+		for _, line := range footer {
+			fmt.Fprint(out, line)
+		}
 	}
 	return nil
 }
 
 func (m *Model) String() string {
 	var str strings.Builder
-	for i, val := range m.Env {
-		if i > 0 {
-			str.WriteRune('\n')
-		}
-		for _, c := range val.Comment {
-			str.WriteString("# ")
-			str.WriteString(c)
-			str.WriteRune('\n')
-		}
-		if !val.UserDef && val.String() == "" {
-			str.WriteString("unset -v ")
-			str.WriteString(val.Ident)
-		} else {
-			str.WriteString("export ")
-			str.WriteString(val.Ident)
-			str.WriteRune('=')
-			fullVal := val.String()
-			trimVal := strings.TrimSpace(fullVal)
-			switch val.VType {
-			case Int, Float, Bool:
-				str.WriteString(trimVal) // Don't quote numbers or booleans
-			case String, JSON, Serial:
-				switch {
-				case strings.HasPrefix(trimVal, "$(") && strings.HasSuffix(trimVal, ")"):
-					str.WriteString(trimVal) // Don't quote command substitution
-				default:
-					str.WriteRune(m.EnvQuote) // Quote everything else,
-					str.WriteString(fullVal)  //  and retain untrimmed values.
-					str.WriteRune(m.EnvQuote)
-				}
-			}
-		}
-		str.WriteRune('\n')
-	}
+	entries, _ := m.Entries(true) // never fails without expanding commands
+	_ = FormatPOSIX.Writer(m.EnvQuote).WriteEnv(&str, entries)
 	return str.String()
 }
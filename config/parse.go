@@ -0,0 +1,282 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Assign is a single statement parsed from a config.env file.
+type Assign struct {
+	Ident   string
+	Value   string
+	Unset   bool     // statement was "unset [-v] ident"
+	Subst   bool     // value is a literal command substitution "$( … )"
+	Line    int      // line number of the statement
+	Comment []string // comment lines immediately preceding the statement
+}
+
+// ParseFile parses the config.env file at path.
+func ParseFile(path string) ([]Assign, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path, err)
+	}
+	defer f.Close()
+	asg, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+	return asg, nil
+}
+
+// Parse parses the subset of shell syntax written by Model.Write:
+//
+//	# comment
+//	export ident='value' other="value" …
+//	ident=value
+//	unset -v ident …
+//
+// Values may concatenate unquoted, single-quoted and double-quoted words.
+// A quoted word or command substitution may span several lines, in which case
+// its value contains the newlines (see QuotePOSIX).
+// Command substitutions "$( … )" are not executed; they are retained
+// literally with Assign.Subst set.
+func Parse(r io.Reader) ([]Assign, error) {
+	var (
+		out     []Assign
+		comment []string
+		line    int
+		start   int    // line number of the first line of stmt
+		stmt    string // statement continued from the preceding lines
+	)
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line++
+		text := scan.Text()
+		if stmt != "" {
+			text = stmt + "\n" + text
+		} else {
+			start = line
+			switch trim := strings.TrimSpace(text); {
+			case trim == "":
+				comment = nil
+				continue
+			case strings.HasPrefix(trim, "#"):
+				if !strings.HasPrefix(trim, "#!") {
+					comment = append(comment, strings.TrimSpace(strings.TrimPrefix(trim, "#")))
+				}
+				continue
+			}
+		}
+		asg, err := parseStatement(strings.TrimSpace(text))
+		if errors.Is(err, errUnterminated) {
+			stmt = text // continue the statement on the next line
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", status.ErrParseEnv, start, err)
+		}
+		for i := range asg {
+			asg[i].Line = start
+			asg[i].Comment = comment
+		}
+		out = append(out, asg...)
+		comment, stmt = nil, ""
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", status.ErrReadFile, err)
+	}
+	if stmt != "" {
+		_, err := parseStatement(strings.TrimSpace(stmt))
+		return nil, fmt.Errorf("%w: line %d: %w", status.ErrParseEnv, start, err)
+	}
+	return out, nil
+}
+
+// errUnterminated is returned by splitWords if a quoted word or command
+// substitution is not closed on the same line.
+var errUnterminated = errors.New("unterminated") //nolint:gochecknoglobals
+
+func parseStatement(text string) ([]Assign, error) {
+	words, err := splitWords(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, nil
+	}
+	var out []Assign
+	switch words[0].text {
+	case "unset":
+		for _, w := range words[1:] {
+			if strings.HasPrefix(w.text, "-") {
+				if w.text != "-v" {
+					return nil, fmt.Errorf("unsupported option: unset %s", w.text)
+				}
+				continue
+			}
+			if !isIdent(w.text) {
+				return nil, fmt.Errorf("invalid identifier: %q", w.text)
+			}
+			out = append(out, Assign{Ident: w.text, Unset: true})
+		}
+		return out, nil
+	case "export":
+		words = words[1:]
+	}
+	for _, w := range words {
+		ident, value, ok := strings.Cut(w.text, "=")
+		if !ok || !w.assign {
+			if words[0].text == "export" || isIdent(w.text) {
+				continue // "export ident" without a value changes nothing
+			}
+			return nil, fmt.Errorf("unsupported statement: %q", text)
+		}
+		if !isIdent(ident) {
+			return nil, fmt.Errorf("invalid identifier: %q", ident)
+		}
+		out = append(out, Assign{Ident: ident, Value: value, Subst: w.subst})
+	}
+	return out, nil
+}
+
+// word is a shell word with its quotes removed.
+type word struct {
+	text   string
+	assign bool // the "=" of ident=value appeared unquoted
+	subst  bool // the word is exactly one command substitution
+}
+
+// splitWords splits a line into shell words, stopping at an unquoted comment.
+//
+//nolint:gocognit,cyclop
+func splitWords(text string) ([]word, error) {
+	var (
+		out  []word
+		curr strings.Builder
+		w    word
+		in   bool // currently inside a word
+	)
+	flush := func() {
+		if in {
+			w.text = curr.String()
+			out = append(out, w)
+		}
+		curr.Reset()
+		w, in = word{}, false
+	}
+	rs := []rune(text)
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case unicode.IsSpace(c):
+			flush()
+		case c == '#' && !in:
+			flush()
+			return out, nil
+		case c == '\'':
+			in = true
+			j := indexRune(rs, i+1, '\'')
+			if j < 0 {
+				return nil, fmt.Errorf("%w single quote", errUnterminated)
+			}
+			curr.WriteString(string(rs[i+1 : j]))
+			i = j
+		case c == '"':
+			in = true
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				switch {
+				case rs[j] == '\\' && j+1 < len(rs) && strings.ContainsRune("\"\\$`", rs[j+1]):
+					j++
+					curr.WriteRune(rs[j])
+				case rs[j] == '$' && j+1 < len(rs) && rs[j+1] == '(':
+					k, err := matchParen(rs, j+1)
+					if err != nil {
+						return nil, err
+					}
+					curr.WriteString(string(rs[j : k+1]))
+					j = k
+				default:
+					curr.WriteRune(rs[j])
+				}
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("%w double quote", errUnterminated)
+			}
+			i = j
+		case c == '\\':
+			in = true
+			if i+1 < len(rs) {
+				i++
+				curr.WriteRune(rs[i])
+			}
+		case c == '$' && i+1 < len(rs) && rs[i+1] == '(':
+			k, err := matchParen(rs, i+1)
+			if err != nil {
+				return nil, err
+			}
+			// The word is a command substitution iff nothing else precedes it
+			// (other than "ident=") and nothing follows it.
+			before := curr.String()
+			w.subst = (before == "" || (w.assign && strings.HasSuffix(before, "="))) &&
+				(k+1 == len(rs) || unicode.IsSpace(rs[k+1]))
+			in = true
+			curr.WriteString(string(rs[i : k+1]))
+			i = k
+		case c == '=' && !w.assign && in && isIdent(curr.String()):
+			w.assign = true
+			curr.WriteRune(c)
+		default:
+			in = true
+			curr.WriteRune(c)
+		}
+	}
+	flush()
+	return out, nil
+}
+
+// matchParen returns the index of the parenthesis closing the one at open.
+func matchParen(rs []rune, open int) (int, error) {
+	depth := 0
+	for i := open; i < len(rs); i++ {
+		switch rs[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return -1, fmt.Errorf("%w command substitution", errUnterminated)
+}
+
+func indexRune(rs []rune, from int, r rune) int {
+	for i := from; i < len(rs); i++ {
+		if rs[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if c != '_' && !unicode.IsLetter(c) && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Assign
+	}{
+		{
+			name: "export",
+			text: "# scheme\n# of the app\nexport proj_scheme='FMPS Calculator'\n",
+			want: []Assign{{Ident: "proj_scheme", Value: "FMPS Calculator", Line: 3,
+				Comment: []string{"scheme", "of the app"}}},
+		},
+		{
+			name: "assignments",
+			text: "#!/bin/sh\n\nexport a=1 b=\"two words\"\nc=x'y'\"z\" # trailing comment\n",
+			want: []Assign{
+				{Ident: "a", Value: "1", Line: 3},
+				{Ident: "b", Value: "two words", Line: 3},
+				{Ident: "c", Value: "xyz", Line: 4},
+			},
+		},
+		{
+			name: "unset",
+			text: "unset -v a b\n",
+			want: []Assign{{Ident: "a", Unset: true, Line: 1}, {Ident: "b", Unset: true, Line: 1}},
+		},
+		{
+			name: "escapes",
+			text: `export a='it'\''s' b="\$HOME \"q\" \\ \` + "`" + `"` + "\n",
+			want: []Assign{
+				{Ident: "a", Value: "it's", Line: 1},
+				{Ident: "b", Value: "$HOME \"q\" \\ `", Line: 1},
+			},
+		},
+		{
+			name: "command substitution",
+			text: "export a=$( xcrun --show-sdk-version ) b=\"$(date)\" c=v$(date)\n",
+			want: []Assign{
+				{Ident: "a", Value: "$( xcrun --show-sdk-version )", Subst: true, Line: 1},
+				{Ident: "b", Value: "$(date)", Line: 1},
+				{Ident: "c", Value: "v$(date)", Line: 1},
+			},
+		},
+		{
+			name: "multi-line",
+			text: "# note\nexport a='one\n  two\n' b=\"x\ny\"\nexport c=$( echo \\\n 1 )\nexport d=4\n",
+			want: []Assign{
+				{Ident: "a", Value: "one\n  two\n", Line: 2, Comment: []string{"note"}},
+				{Ident: "b", Value: "x\ny", Line: 2, Comment: []string{"note"}},
+				{Ident: "c", Value: "$( echo \\\n 1 )", Subst: true, Line: 6},
+				{Ident: "d", Value: "4", Line: 8},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.text))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q):\ngot  %+v\nwant %+v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		line string
+	}{
+		{"unterminated single quote", "export a=1\nexport b='x\ny\n", "line 2"},
+		{"unterminated double quote", "export b=\"x\n", "line 1"},
+		{"unterminated substitution", "export c=$( echo\n", "line 1"},
+		{"invalid identifier", "export 1a=x\n", "line 1"},
+		{"unsupported statement", "rm -f config.env\n", "line 1"},
+		{"unsupported option", "unset -f a\n", "line 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.text))
+			if !errors.Is(err, status.ErrParseEnv) || !strings.Contains(err.Error(), tt.line) {
+				t.Errorf("Parse(%q) = %v, want %v at %s", tt.text, err, status.ErrParseEnv, tt.line)
+			}
+		})
+	}
+}
+
+// TestWriteParse writes values that need quoting and reads them back.
+func TestWriteParse(t *testing.T) {
+	values := []string{
+		"FMPS Calculator",
+		"line one\nline two\n",
+		"\n  indented\n\ttabbed\n\n",
+		"it's a 'quote'",
+		`"double" and \backslash\`,
+		"$HOME and `date` and $( date )",
+		"# not a comment\nexport other='x'",
+	}
+	for _, quote := range []rune{'\'', '"'} {
+		for _, val := range values {
+			t.Run(string(quote)+val, func(t *testing.T) {
+				m := new(Model)
+				if err := m.Init(nil); err != nil {
+					t.Fatal(err)
+				}
+				m.EnvQuote = quote
+				v, _ := m.Env.Lookup("proj_scheme")
+				if err := v.Set(val); err != nil {
+					t.Fatal(err)
+				}
+				v.UserDef = true
+				var out strings.Builder
+				if err := m.Write(&out); err != nil {
+					t.Fatal(err)
+				}
+				asg, err := Parse(strings.NewReader(out.String()))
+				if err != nil {
+					t.Fatalf("%v\n%s", err, out.String())
+				}
+				got := new(Model)
+				if err = got.Init(nil); err != nil {
+					t.Fatal(err)
+				}
+				if err = got.Env.Load(asg, SourceFile, "test"); err != nil {
+					t.Fatal(err)
+				}
+				if gv, _ := got.Env.Lookup("proj_scheme"); gv.String() != val {
+					t.Errorf("proj_scheme = %q, want %q\n%s", gv.String(), val, out.String())
+				}
+				if other, _ := got.Env.Lookup("other"); other != nil {
+					t.Errorf("value escaped its quotes:\n%s", out.String())
+				}
+				// Every other variable is read back unchanged.
+				for _, want := range m.Env {
+					gv, _ := got.Env.Lookup(want.Ident)
+					if gv.String() != want.String() {
+						t.Errorf("%s = %q, want %q", want.Ident, gv.String(), want.String())
+					}
+				}
+			})
+		}
+	}
+}
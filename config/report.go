@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Report describes the resolved configuration and the command that launches
+// Appium with it, for consumption by other tools.
+type Report struct {
+	Version    int         `json:"version"`    // schema version (ReportVersion)
+	Executable string      `json:"executable"` // absolute path of appium-agent
+	Argv       []string    `json:"argv"`       // launch command
+	Vars       []VarReport `json:"vars"`
+}
+
+// VarReport describes a single configuration parameter.
+//
+// All values are given in config.env syntax (unquoted), and the items of an
+// aggregate parameter are separated by ListSep. Env is null if the parameter
+// is not inherited from the environment.
+type VarReport struct {
+	Ident       string  `json:"ident"`
+	Flag        string  `json:"flag"`
+	Short       string  `json:"short,omitempty"`
+	Type        string  `json:"type"`
+	Aggregate   bool    `json:"aggregate"`
+	Value       string  `json:"value"`
+	Default     string  `json:"default"`
+	Env         *string `json:"env"`
+	UserDefined bool    `json:"user_defined"`
+	Source      string  `json:"source"`
+	Origin      string  `json:"origin,omitempty"`
+
+	Chain []Definition `json:"chain"` // provenance, in the order encountered
+}
+
+// Report returns the description of m and the launch command argv.
+func (m *Model) Report(exe string, argv []string) Report {
+	def := DefaultEnv()
+	r := Report{
+		Version:    ReportVersion,
+		Executable: exe,
+		Argv:       argv,
+		Vars:       make([]VarReport, 0, len(m.Env)),
+	}
+	for _, v := range m.Env {
+		vr := VarReport{
+			Ident:       v.Ident,
+			Flag:        v.Flag,
+			Short:       v.PFlag,
+			Type:        v.VType.String(),
+			Aggregate:   v.Aggr,
+			Value:       v.String(),
+			UserDefined: v.UserDef,
+			Source:      v.Source.String(),
+			Origin:      v.Origin,
+			Chain:       v.Chain,
+		}
+		if d, ok := def.Lookup(v.Ident); ok && !m.Zero {
+			vr.Default = d.String()
+		}
+		if _, ok := os.LookupEnv(v.Ident); ok && !v.Orphan {
+			env := v.envString()
+			vr.Env = &env
+		}
+		r.Vars = append(r.Vars, vr)
+	}
+	return r
+}
+
+// WriteJSON writes r to out as indented JSON.
+func (r Report) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("encode configuration report: %w", err)
+	}
+	return nil
+}
+
+// WriteExplain writes the provenance chain of each of vars, marking the
+// definition of its current value with "*" and giving the reason each other
+// definition was not used.
+func WriteExplain(out io.Writer, vars ...*Var) error {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0) //nolint:gomnd,mnd
+	for i, v := range vars {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s (--%s) = %s\n", v.Ident, v.Flag, strconv.Quote(v.String()))
+		win := v.winner()
+		for j, d := range v.Chain {
+			mark, note := " ", d.Ignored
+			switch {
+			case j == win:
+				mark = "*"
+			case note == "":
+				note = "shadowed by " + v.Chain[win].String()
+			}
+			fmt.Fprintf(w, "  %s %s\t%s\t%s\t%s\n",
+				mark, d.Source, d.Origin, strconv.Quote(d.Value), note)
+		}
+		if win < 0 {
+			fmt.Fprintln(w, "    (undefined)")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Remove the padding of empty notes.
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		if _, err := io.WriteString(out, strings.TrimRight(line, " \n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -12,6 +12,11 @@ const (
 	String
 	JSON
 	Serial
+	Duration // time.Duration, e.g., "90s" or "1h30m"
+	Path     // file path, expanded and made absolute
+	Enum     // one of the Choices of a Var
+	URL      // absolute URL with scheme and host
+	Version  // dotted version number, e.g., "17.4"
 )
 
 func (t Type) String() string {
@@ -30,6 +35,16 @@ func (t Type) String() string {
 		return "json"
 	case Serial:
 		return "serial"
+	case Duration:
+		return "duration"
+	case Path:
+		return "path"
+	case Enum:
+		return "enum"
+	case URL:
+		return "url"
+	case Version:
+		return "version"
 	}
 	return ""
 }
@@ -48,6 +63,80 @@ func ParseType(s string) Type {
 		return JSON
 	case "serial":
 		return Serial
+	case "duration":
+		return Duration
+	case "path":
+		return Path
+	case "enum":
+		return Enum
+	case "url":
+		return URL
+	case "version":
+		return Version
 	}
 	return Invalid
 }
+
+// Source identifies where the value of a Var was defined.
+type Source int
+
+const (
+	SourceDefault Source = iota
+	SourceEnv
+	SourceFile
+	SourceProfile
+	SourceFlag
+	SourceDerived // derived from another flag, e.g., --debug-config
+	SourceSystem  // system configuration layer (see SystemLayer)
+	SourceUser    // user configuration layer (see UserLayer)
+	SourceProject // project configuration layer (see FindProjectLayer)
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceEnv:
+		return "env"
+	case SourceFile:
+		return "file"
+	case SourceProfile:
+		return "profile"
+	case SourceFlag:
+		return "flag"
+	case SourceDerived:
+		return "derived"
+	case SourceSystem:
+		return "system"
+	case SourceUser:
+		return "user"
+	case SourceProject:
+		return "project"
+	}
+	return ""
+}
+
+// IsLayer reports whether s is a configuration layer.
+func (s Source) IsLayer() bool {
+	return s == SourceSystem || s == SourceUser || s == SourceProject
+}
+
+func (s Source) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Definition is an entry in the provenance chain of a Var, recording a single
+// definition of its value in the order they were encountered.
+type Definition struct {
+	Source  Source `json:"source"`
+	Origin  string `json:"origin,omitempty"`  // location, e.g., "path:line"
+	Value   string `json:"value"`             // value in config.env syntax
+	Ignored string `json:"ignored,omitempty"` // why it was not applied, if not
+}
+
+func (d Definition) String() string {
+	if d.Origin == "" {
+		return d.Source.String()
+	}
+	return d.Source.String() + " " + d.Origin
+}
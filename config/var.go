@@ -7,6 +7,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/muesli/reflow/indent"
@@ -26,18 +27,129 @@ type Var struct {
 	Orphan   bool
 	Value    any
 	EnvValue any
+	Source   Source // where Value was defined
+	Origin   string // location of the definition, e.g., "path:line"
+
+	Chain []Definition // provenance of Value (see Define and Ignore)
+
+	Constraints []Constraint // requirements of a valid value (see Check)
+	Choices     []string     // allowed values of an Enum (see Allow)
+	Exec        bool         // the default may be executed (see ExecDefault)
+
+	accum bool // Set appends to an aggregate value (see Reset)
 }
 
 func NewVar(long, short, ident string, t Type, value any, comment ...string) *Var {
-	return &Var{
+	v := &Var{
 		Flag: long, PFlag: short, Ident: ident, VType: t, Aggr: false, Value: value, EnvValue: os.Getenv(ident), Comment: comment,
 	}
+	v.Define(SourceDefault, "")
+	return v
 }
 
 func NewAggregrateVar(long, short, ident string, t Type, comment ...string) *Var {
-	return &Var{
+	v := &Var{
 		Flag: long, PFlag: short, Ident: ident, VType: t, Aggr: true, Value: nil, EnvValue: nil, Comment: comment,
 	}
+	v.Define(SourceDefault, "")
+	return v
+}
+
+// Define marks the current value of v as defined by src at origin,
+// and appends it to the provenance chain of v.
+func (v *Var) Define(src Source, origin string) {
+	v.Source, v.Origin = src, origin
+	v.Chain = append(v.Chain, Definition{Source: src, Origin: origin, Value: v.String()})
+}
+
+// Ignore appends a definition of v by src at origin that was not applied
+// to the provenance chain of v, along with the reason it was not.
+// An empty reason means it was shadowed by the current value of v.
+func (v *Var) Ignore(src Source, origin, value, reason string) {
+	if reason == "" {
+		reason = v.shadowed()
+	}
+	v.Chain = append(v.Chain,
+		Definition{Source: src, Origin: origin, Value: value, Ignored: reason})
+}
+
+// Revoke marks the definition of the current value of v as not applied,
+// e.g., when a default value is removed by --zero.
+func (v *Var) Revoke(reason string) {
+	if i := v.winner(); i >= 0 {
+		v.Chain[i].Ignored = reason
+	}
+}
+
+// Winner returns the definition of the current value of v, if any.
+func (v *Var) Winner() (Definition, bool) {
+	if i := v.winner(); i >= 0 {
+		return v.Chain[i], true
+	}
+	return Definition{}, false
+}
+
+// winner returns the index in the provenance chain of the last definition
+// applied, or -1 if there is none.
+func (v *Var) winner() int {
+	for i := len(v.Chain) - 1; i >= 0; i-- {
+		if v.Chain[i].Ignored == "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// shadowed returns the reason a definition given after the current value
+// of v was not applied.
+func (v *Var) shadowed() string {
+	if d, ok := v.Winner(); ok {
+		return "shadowed by " + d.String()
+	}
+	return "shadowed"
+}
+
+// Reset causes the next call to Set of an aggregate variable to replace its
+// value instead of appending to it.
+func (v *Var) Reset() { v.accum = false }
+
+// List returns the items of an aggregate variable.
+func (v *Var) List() []string {
+	return SplitList(v.String())
+}
+
+// Require appends constraints on the value of v and returns v.
+func (v *Var) Require(c ...Constraint) *Var {
+	v.Constraints = append(v.Constraints, c...)
+	return v
+}
+
+// Allow sets the values permitted for an Enum variable and returns v.
+func (v *Var) Allow(choices ...string) *Var {
+	v.Choices = append(v.Choices, choices...)
+	return v
+}
+
+// Default replaces the default value of v, e.g., with the items of an
+// aggregate variable, and returns v.
+func (v *Var) Default(value any) *Var {
+	v.Value = value
+	v.Chain[0].Value = v.String()
+	return v
+}
+
+// ExecDefault marks the default value of v as a command substitution that
+// the shell may execute when sourcing the configuration, and returns v.
+// Any other command substitution requires Model.AllowExec.
+func (v *Var) ExecDefault() *Var {
+	v.Exec = true
+	return v
+}
+
+// execDefault reports whether s is the default value of v and may be executed.
+func (v *Var) execDefault(s string) bool {
+	return v.Exec && len(v.Chain) > 0 && v.Chain[0].Source == SourceDefault &&
+		strings.TrimSpace(v.Chain[0].Value) == s
 }
 
 func (v *Var) IsBoolFlag() bool {
@@ -60,6 +172,10 @@ func (v *Var) String() string {
 		return encode(v, encodeJSON)
 	case Serial:
 		return encode(v, encodeSerial)
+	case Duration:
+		return encode(v, time.Duration.String)
+	case Path, Enum, URL, Version:
+		return encode(v, func(s string) string { return s })
 	}
 	return ""
 }
@@ -80,15 +196,40 @@ func (v *Var) Set(s string) error {
 		return decode(v, s, decodeJSON(v))
 	case Serial:
 		return decode(v, s, decodeSerial(v))
+	case Duration:
+		return decode(v, s, decodeDuration)
+	case Path:
+		return decode(v, s, verbatim(ExpandPath))
+	case Enum:
+		if v.Aggr && !IsCommandSubst(s) {
+			// Choices never contain spaces, so the items may also be separated
+			// by whitespace, e.g., "clean build test".
+			s = strings.Join(strings.Fields(strings.ReplaceAll(s, ListSep, " ")), ListSep)
+		}
+		return decode(v, s, verbatim(decodeEnum(v)))
+	case URL:
+		return decode(v, s, verbatim(decodeURL))
+	case Version:
+		return decode(v, s, verbatim(decodeVersion))
 	}
 	return nil
 }
 
+// envString returns the value of v inherited from the environment.
+func (v *Var) envString() string {
+	e := *v
+	e.UserDef, e.Zero = false, true
+	return e.String()
+}
+
 func (v *Var) Type() string { return v.VType.String() }
 
 func (v *Var) Usage() string {
 	var top, buf bytes.Buffer
 	name, usage := v.parseFlagUsage()
+	if note := v.choices(); note != "" {
+		usage += "\n" + note
+	}
 	for range padlen {
 		top.WriteRune(' ')
 	}
@@ -204,3 +345,11 @@ func (v *Var) parseFlagUsage() (name string, usage string) {
 	}
 	return strings.ToUpper(v.VType.String()), usage
 }
+
+// choices returns the usage note listing the allowed values of an Enum.
+func (v *Var) choices() string {
+	if v.VType != Enum || len(v.Choices) == 0 {
+		return ""
+	}
+	return "(one of: " + strings.Join(v.Choices, ", ") + ")"
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/appium"
+	"github.com/ardnew/appium-agent/command"
+	"github.com/ardnew/appium-agent/rotate"
+	"github.com/ardnew/appium-agent/status"
+	"github.com/ardnew/appium-agent/supervisor"
+)
+
+// defaultLogMaxSize is the size (MiB) at which a running session log is rotated.
+const defaultLogMaxSize = 64
+
+type daemonOpts struct {
+	appium      string
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	crashWindow time.Duration
+	maxCrashes  int
+	restart     bool
+	logMaxSize  int64
+	policy      rotate.Policy
+}
+
+func (o *daemonOpts) flags(a *agent, fset *flag.FlagSet) {
+	addConfigFlags(a, fset)
+	fset.StringVar(&o.appium, "appium-bin", "appium",
+		"`path` of the Appium executable")
+	fset.DurationVar(&o.minBackoff, "backoff", supervisor.DefaultMinBackoff,
+		"Initial `delay` before restarting Appium after it crashes")
+	fset.DurationVar(&o.maxBackoff, "max-backoff", supervisor.DefaultMaxBackoff,
+		"Maximum `delay` before restarting Appium (backoff doubles each restart)")
+	fset.DurationVar(&o.crashWindow, "crash-window", supervisor.DefaultCrashWindow,
+		"Give up if Appium crashes --max-crashes times within `duration`")
+	fset.IntVar(&o.maxCrashes, "max-crashes", supervisor.DefaultMaxCrashes,
+		"Give up if Appium crashes `count` times within --crash-window")
+	fset.BoolVar(&o.restart, "restart-clean", false,
+		"Also restart Appium after it exits successfully (status 0)")
+	addPortFlags(a, fset)
+	addRotateFlags(&o.policy, fset)
+	fset.Int64Var(&o.logMaxSize, "log-max-size", defaultLogMaxSize,
+		"Rotate the session log when it exceeds `MiB` megabytes (0 disables)")
+}
+
+// run supervises "appium server" in the foreground until interrupted.
+func (o *daemonOpts) run(a *agent, _ []string) error {
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if err := o.policy.Validate(); err != nil {
+		return fmt.Errorf("--keep: %w", err)
+	}
+	root := a.cmd.Root()
+	if st, ok := supervisor.Active(command.AppiumdStateFile(root)); ok {
+		// Refuse before rotating the logs of the running supervisor.
+		return fmt.Errorf("%w: pid %d", status.ErrAlreadyRunning, st.PID)
+	}
+	if _, err := a.checkPorts(); err != nil {
+		return err
+	}
+	cfgJSON := command.AppiumdConfigJSON(root)
+	sch, err := appium.DefaultSchema()
+	if err != nil {
+		return fmt.Errorf("load Appium schema: %w", err)
+	}
+	if err = appium.Generate(cfgJSON, command.AppiumdConfigLock(root), a.cfg, sch); err != nil {
+		return fmt.Errorf("generate Appium config.json: %w", err)
+	}
+	addr, err := a.listenAddress()
+	if err != nil {
+		return err
+	}
+	port, _ := a.cfg.Env.Lookup("listen_port")
+
+	if err = rotateLogs(root, o.policy); err != nil {
+		return err
+	}
+	o.policy.MaxSize = o.logMaxSize << 20 //nolint:gomnd,mnd
+	logFile, err := rotate.Open(command.AppiumdSessionLog(root), o.policy)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	sup := &supervisor.Supervisor{
+		Path: o.appium,
+		Args: []string{
+			"server",
+			"--address", addr,
+			"--port", port.String(),
+			"--config", cfgJSON,
+		},
+		Dir:          root,
+		Env:          os.Environ(),
+		Output:       io.MultiWriter(logFile, os.Stdout),
+		StatePath:    command.AppiumdStateFile(root),
+		PIDPath:      command.AppiumdPIDFile(root),
+		MinBackoff:   o.minBackoff,
+		MaxBackoff:   o.maxBackoff,
+		CrashWindow:  o.crashWindow,
+		MaxCrashes:   o.maxCrashes,
+		RestartClean: o.restart,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err = sup.Run(ctx); err != nil {
+		return fmt.Errorf("supervise Appium: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/device"
+)
+
+// deviceListTimeout limits the time spent listing devices with xcrun.
+const deviceListTimeout = 30 * time.Second
+
+func addDeviceFlags(a *agent, fset *flag.FlagSet) {
+	fset.StringVar(&a.devices.DevicectlJSON, "devicectl-json", "",
+		"Read physical devices from `path` instead of \"xcrun devicectl list devices --json-output\"")
+	fset.StringVar(&a.devices.SimctlJSON, "simctl-json", "",
+		"Read simulators from `path` instead of \"xcrun simctl list -j devices\"")
+}
+
+func runDevices(a *agent, _ []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deviceListTimeout)
+	defer cancel()
+	devs, err := a.devices.List(ctx)
+	if err != nil {
+		if len(devs) == 0 {
+			return fmt.Errorf("list devices: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0) //nolint:gomnd,mnd
+	fmt.Fprintln(w, "NAME\tUDID\tOS\tMODEL\tCONNECTION\tSTATE")
+	for _, d := range devs {
+		fmt.Fprintf(w, "%s\t%s\t%s %s\t%s\t%s\t%s\n",
+			d.Name, d.UDID, d.Platform, d.OSVersion, d.Model, d.Connection, d.State)
+	}
+	return w.Flush()
+}
+
+// checkDevice verifies that target-device identifies an available device
+// and replaces a device name with its UDID.
+//
+// If no device list could be read from xcrun (e.g., on hosts without Xcode),
+// the check is skipped with a warning written to stderr.
+func (a *agent) checkDevice() error {
+	v, ok := a.cfg.Env.Lookup("target_dest")
+	if !ok || v.String() == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deviceListTimeout)
+	defer cancel()
+	devs, err := a.devices.List(ctx)
+	if err != nil && len(devs) == 0 {
+		if a.devices != (device.Source{}) {
+			return fmt.Errorf("list devices: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: cannot verify target device: %v\n", err)
+		return nil
+	}
+	d, err := device.Find(devs, v.String())
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(v.String(), device.UDIDPrefix) {
+		if a.verbose {
+			fmt.Printf("target device %q: %s\n", v.String(), d.UDID)
+		}
+		return v.Set(device.UDIDPrefix + d.UDID)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package device
+
+// Connection describes how a device is connected to the host.
+type Connection string
+
+const (
+	Wired     Connection = "usb"
+	Network   Connection = "network"
+	Simulator Connection = "simulator"
+	Offline   Connection = "offline" // paired, but not currently reachable
+)
+
+// UDIDPrefix is prefixed to a UDID in target-device (and xcodebuild
+// -destination) to distinguish it from a device name.
+const UDIDPrefix = "id="
@@ -0,0 +1,128 @@
+package device
+
+// Standalone functions (non-methods) supporting type Device.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// ParseDevicectl returns the physical devices described by the JSON output of
+// "xcrun devicectl list devices --json-output".
+func ParseDevicectl(r io.Reader) ([]Device, error) {
+	var list devicectlList
+	if err := decode(r, &list); err != nil {
+		return nil, err
+	}
+	out := make([]Device, 0, len(list.Result.Devices))
+	for _, d := range list.Result.Devices {
+		hw := d.HardwareProperties
+		if hw.Reality != "" && hw.Reality != "physical" {
+			continue
+		}
+		dev := Device{
+			Name:       d.DeviceProperties.Name,
+			UDID:       hw.UDID,
+			Platform:   hw.Platform,
+			OSVersion:  d.DeviceProperties.OSVersionNumber,
+			Model:      hw.MarketingName,
+			Connection: Offline,
+			State:      d.ConnectionProperties.TunnelState,
+		}
+		if dev.State == "connected" {
+			switch d.ConnectionProperties.TransportType {
+			case "wired":
+				dev.Connection = Wired
+			case "localNetwork":
+				dev.Connection = Network
+			}
+		}
+		out = append(out, dev)
+	}
+	return out, nil
+}
+
+// ParseSimctl returns the available simulators described by the JSON output
+// of "xcrun simctl list -j devices".
+func ParseSimctl(r io.Reader) ([]Device, error) {
+	var list simctlList
+	if err := decode(r, &list); err != nil {
+		return nil, err
+	}
+	var out []Device
+	for runtime, devs := range list.Devices {
+		platform, version := parseRuntime(runtime)
+		for _, d := range devs {
+			if !d.IsAvailable {
+				continue
+			}
+			out = append(out, Device{
+				Name:       d.Name,
+				UDID:       d.UDID,
+				Platform:   platform,
+				OSVersion:  version,
+				Model:      parseDeviceType(d.DeviceTypeIdentifier),
+				Connection: Simulator,
+				State:      d.State,
+			})
+		}
+	}
+	return out, nil
+}
+
+// parseRuntime returns the platform and version of a simulator runtime
+// identifier, e.g., "com.apple.CoreSimulator.SimRuntime.iOS-17-4" yields
+// "iOS" and "17.4".
+func parseRuntime(id string) (platform, version string) {
+	name := id[strings.LastIndex(id, ".")+1:]
+	platform, version, _ = strings.Cut(name, "-")
+	return platform, strings.ReplaceAll(version, "-", ".")
+}
+
+// parseDeviceType returns the model of a simulator device type identifier,
+// e.g., "com.apple.CoreSimulator.SimDeviceType.iPhone-15-Pro" yields
+// "iPhone 15 Pro".
+func parseDeviceType(id string) string {
+	return strings.ReplaceAll(id[strings.LastIndex(id, ".")+1:], "-", " ")
+}
+
+// Find returns the device selected by sel, which is either a UDID (optionally
+// prefixed with "id=") or a device name. Names are compared without regard
+// to case and must identify exactly one device.
+func Find(devs []Device, sel string) (Device, error) {
+	if udid, ok := strings.CutPrefix(sel, UDIDPrefix); ok {
+		sel = udid
+	}
+	var named []Device
+	for _, d := range devs {
+		if strings.EqualFold(d.UDID, sel) {
+			return d, nil
+		}
+		if strings.EqualFold(d.Name, sel) {
+			named = append(named, d)
+		}
+	}
+	switch len(named) {
+	case 1:
+		return named[0], nil
+	case 0:
+		return Device{}, fmt.Errorf("%w: %q not found; available devices:\n%s",
+			status.ErrInvalidDevice, sel, describe(devs))
+	}
+	return Device{}, fmt.Errorf("%w: %q matches %d devices (select by UDID instead):\n%s",
+		status.ErrInvalidDevice, sel, len(named), describe(named))
+}
+
+func describe(devs []Device) string {
+	if len(devs) == 0 {
+		return "\t(none)"
+	}
+	lines := make([]string, len(devs))
+	for i, d := range devs {
+		lines[i] = fmt.Sprintf("\t%s\t%s (%s %s, %s)", d.UDID, d.Name, d.Platform, d.OSVersion, d.Connection)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,184 @@
+package device
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+func parseFixture(t *testing.T, name string, parse func(f *os.File) ([]Device, error)) []Device {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	devs, err := parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return devs
+}
+
+func TestParseDevicectl(t *testing.T) {
+	got := parseFixture(t, "devicectl.json", func(f *os.File) ([]Device, error) { return ParseDevicectl(f) })
+	want := []Device{
+		{
+			Name: "FSDS iPhone", UDID: "00008101-0005499E010B001E", Platform: "iOS",
+			OSVersion: "17.4.1", Model: "iPhone 12", Connection: Wired, State: "connected",
+		},
+		{
+			Name: "FSDS iPad", UDID: "00008030-001A2D4C3E88802E", Platform: "iOS",
+			OSVersion: "16.7.2", Model: "iPad (9th generation)", Connection: Offline, State: "disconnected",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDevicectl:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseDevicectlConnection(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		tunnel    string
+		reality   string
+		want      Connection // "" if the device is omitted
+	}{
+		{"wired", "wired", "connected", "physical", Wired},
+		{"network", "localNetwork", "connected", "physical", Network},
+		{"offline wired", "wired", "disconnected", "physical", Offline},
+		{"offline network", "localNetwork", "unavailable", "", Offline},
+		{"unknown transport", "bluetooth", "connected", "physical", Offline},
+		{"virtual", "wired", "connected", "virtual", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `{"result":{"devices":[{` +
+				`"connectionProperties":{"transportType":"` + tt.transport + `","tunnelState":"` + tt.tunnel + `"},` +
+				`"deviceProperties":{"name":"Dev","osVersionNumber":"17.0"},` +
+				`"hardwareProperties":{"udid":"UDID","platform":"iOS","reality":"` + tt.reality + `"}}]}}`
+			devs, err := ParseDevicectl(strings.NewReader(doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.want == "" && len(devs) != 0:
+				t.Errorf("got %+v, want no devices", devs)
+			case tt.want != "" && (len(devs) != 1 || devs[0].Connection != tt.want):
+				t.Errorf("got %+v, want connection %q", devs, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDevicectlInvalid(t *testing.T) {
+	if _, err := ParseDevicectl(strings.NewReader("{")); err == nil {
+		t.Error("ParseDevicectl(invalid JSON) succeeded")
+	}
+}
+
+func TestParseSimctl(t *testing.T) {
+	got := parseFixture(t, "simctl.json", func(f *os.File) ([]Device, error) { return ParseSimctl(f) })
+	// Runtimes are decoded from a map, so the order is unspecified.
+	sort.Slice(got, func(i, j int) bool { return got[i].UDID < got[j].UDID })
+	want := []Device{
+		{
+			Name: "iPad Air 11-inch (M2)", UDID: "0D4E2F61-7A8B-4C9D-8E0F-1A2B3C4D5E6F", Platform: "iOS",
+			OSVersion: "17.4", Model: "iPad Air 11 inch M2", Connection: Simulator, State: "Shutdown",
+		},
+		{
+			Name: "iPhone 15 Pro", UDID: "6A1C2B53-0F0E-4C1D-9E3A-5B7C8D9E0F12", Platform: "iOS",
+			OSVersion: "17.4", Model: "iPhone 15 Pro", Connection: Simulator, State: "Booted",
+		},
+		{
+			// The unavailable "iPhone 14" (1B2C3D4E-…) is omitted.
+			Name: "iPhone 14", UDID: "9F8E7D6C-5B4A-4938-8271-605F4E3D2C1B", Platform: "iOS",
+			OSVersion: "16.4", Model: "iPhone 14", Connection: Simulator, State: "Shutdown",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSimctl:\ngot  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseRuntime(t *testing.T) {
+	tests := []struct {
+		id       string
+		platform string
+		version  string
+	}{
+		{"com.apple.CoreSimulator.SimRuntime.iOS-17-4", "iOS", "17.4"},
+		{"com.apple.CoreSimulator.SimRuntime.iOS-16-4-1", "iOS", "16.4.1"},
+		{"com.apple.CoreSimulator.SimRuntime.watchOS-10-2", "watchOS", "10.2"},
+		{"com.apple.CoreSimulator.SimRuntime.xrOS-1-0", "xrOS", "1.0"},
+		{"iOS-18", "iOS", "18"},
+		{"com.apple.CoreSimulator.SimRuntime.iOS", "iOS", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			platform, version := parseRuntime(tt.id)
+			if platform != tt.platform || version != tt.version {
+				t.Errorf("parseRuntime(%q) = %q, %q; want %q, %q",
+					tt.id, platform, version, tt.platform, tt.version)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	devs := []Device{
+		{Name: "FSDS iPhone", UDID: "00008101-0005499E010B001E", Connection: Wired},
+		{Name: "FSDS iPad", UDID: "00008030-001A2D4C3E88802E", Connection: Offline},
+		{Name: "iPhone 14", UDID: "9F8E7D6C-5B4A-4938-8271-605F4E3D2C1B", Connection: Simulator},
+		{Name: "iPhone 14", UDID: "1B2C3D4E-5F60-4718-9A0B-C1D2E3F40516", Connection: Simulator},
+	}
+	tests := []struct {
+		name string
+		sel  string
+		want string // UDID, or "" if an error is expected
+	}{
+		{"udid", "00008101-0005499E010B001E", "00008101-0005499E010B001E"},
+		{"prefixed udid", "id=00008030-001A2D4C3E88802E", "00008030-001A2D4C3E88802E"},
+		{"udid ignores case", "id=9f8e7d6c-5b4a-4938-8271-605f4e3d2c1b", "9F8E7D6C-5B4A-4938-8271-605F4E3D2C1B"},
+		{"name", "FSDS iPad", "00008030-001A2D4C3E88802E"},
+		{"name ignores case", "fsds iphone", "00008101-0005499E010B001E"},
+		{"ambiguous name", "iPhone 14", ""},
+		{"unknown name", "iPhone 99", ""},
+		{"unknown udid", "id=00000000-0000000000000000", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Find(devs, tt.sel)
+			if tt.want == "" {
+				if !errors.Is(err, status.ErrInvalidDevice) {
+					t.Errorf("Find(%q) = %+v, %v; want %v", tt.sel, d, err, status.ErrInvalidDevice)
+				}
+				return
+			}
+			if err != nil || d.UDID != tt.want {
+				t.Errorf("Find(%q) = %q, %v; want %q", tt.sel, d.UDID, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAmbiguousListsCandidates(t *testing.T) {
+	devs := parseFixture(t, "simctl.json", func(f *os.File) ([]Device, error) { return ParseSimctl(f) })
+	devs = append(devs, Device{Name: "iPhone 15 Pro", UDID: "00008120-000A1B2C3D4E5F60", Connection: Wired})
+	_, err := Find(devs, "iPhone 15 Pro")
+	if err == nil {
+		t.Fatal("Find(ambiguous name) succeeded")
+	}
+	for _, udid := range []string{"6A1C2B53-0F0E-4C1D-9E3A-5B7C8D9E0F12", "00008120-000A1B2C3D4E5F60"} {
+		if !strings.Contains(err.Error(), udid) {
+			t.Errorf("error does not list candidate %s:\n%v", udid, err)
+		}
+	}
+}
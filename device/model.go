@@ -0,0 +1,150 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Device is a physical device or simulator available to the host.
+type Device struct {
+	Name       string
+	UDID       string
+	Platform   string // e.g., "iOS"
+	OSVersion  string
+	Model      string // e.g., "iPhone 12" or "iPhone 15 Pro"
+	Connection Connection
+	State      string // e.g., "connected" or "Booted"
+}
+
+// Source locates the JSON device lists from which devices are read.
+// Empty paths are read from the output of xcrun(1) instead.
+type Source struct {
+	DevicectlJSON string // output of "xcrun devicectl list devices --json-output"
+	SimctlJSON    string // output of "xcrun simctl list -j devices"
+}
+
+// List returns all devices and simulators, ordered by connection and name.
+//
+// If one list cannot be read, the devices from the other are still returned
+// along with the error.
+func (s Source) List(ctx context.Context) ([]Device, error) {
+	var (
+		out  []Device
+		errs []error
+	)
+	if dev, err := s.devicectl(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		out = append(out, dev...)
+	}
+	if sim, err := s.simctl(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		out = append(out, sim...)
+	}
+	order := []Connection{Wired, Network, Offline, Simulator}
+	slices.SortStableFunc(out, func(a, b Device) int {
+		if c := slices.Index(order, a.Connection) - slices.Index(order, b.Connection); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return out, errors.Join(errs...)
+}
+
+func (s Source) devicectl(ctx context.Context) ([]Device, error) {
+	if s.DevicectlJSON != "" {
+		return readFile(s.DevicectlJSON, ParseDevicectl)
+	}
+	// devicectl writes its JSON only to a file.
+	tmp, err := os.CreateTemp("", "devicectl-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", status.ErrWriteFile, err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	cmd := exec.CommandContext(ctx, "xcrun", "devicectl", "list", "devices",
+		"--quiet", "--json-output", tmp.Name())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return nil, fmt.Errorf("xcrun devicectl: %w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("xcrun devicectl: %w", err)
+	}
+	return readFile(tmp.Name(), ParseDevicectl)
+}
+
+func (s Source) simctl(ctx context.Context) ([]Device, error) {
+	if s.SimctlJSON != "" {
+		return readFile(s.SimctlJSON, ParseSimctl)
+	}
+	out, err := exec.CommandContext(ctx, "xcrun", "simctl", "list", "-j", "devices").Output()
+	if err != nil {
+		return nil, fmt.Errorf("xcrun simctl: %w", err)
+	}
+	return ParseSimctl(strings.NewReader(string(out)))
+}
+
+func readFile(path string, parse func(io.Reader) ([]Device, error)) ([]Device, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path, err)
+	}
+	defer f.Close()
+	dev, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %w", path, err)
+	}
+	return dev, nil
+}
+
+// devicectlList is the subset of "xcrun devicectl list devices" JSON output
+// describing each device.
+type devicectlList struct {
+	Result struct {
+		Devices []struct {
+			ConnectionProperties struct {
+				TransportType string `json:"transportType"` // "wired" or "localNetwork"
+				TunnelState   string `json:"tunnelState"`
+			} `json:"connectionProperties"`
+			DeviceProperties struct {
+				Name            string `json:"name"`
+				OSVersionNumber string `json:"osVersionNumber"`
+			} `json:"deviceProperties"`
+			HardwareProperties struct {
+				UDID          string `json:"udid"`
+				Platform      string `json:"platform"`
+				MarketingName string `json:"marketingName"`
+				Reality       string `json:"reality"`
+			} `json:"hardwareProperties"`
+		} `json:"devices"`
+	} `json:"result"`
+}
+
+// simctlList is the subset of "xcrun simctl list -j devices" JSON output
+// describing each simulator, keyed by runtime identifier.
+type simctlList struct {
+	Devices map[string][]struct {
+		Name                 string `json:"name"`
+		UDID                 string `json:"udid"`
+		State                string `json:"state"`
+		IsAvailable          bool   `json:"isAvailable"`
+		DeviceTypeIdentifier string `json:"deviceTypeIdentifier"`
+	} `json:"devices"`
+}
+
+func decode(r io.Reader, v any) error {
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("%w: %w", status.ErrInvalidJSON, err)
+	}
+	return nil
+}
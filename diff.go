@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+const proposedConfig = "(proposed)"
+
+type diffOpts struct {
+	backup bool
+}
+
+func (o *diffOpts) flags(a *agent, fset *flag.FlagSet) {
+	addConfigFlags(a, fset)
+	fset.BoolVarP(&o.backup, "backup", "B", false,
+		"Compare from the backup configuration ("+config.BackupIdent+")\n"+
+			"instead of the installed configuration")
+	fset.BoolVarP(&a.installed, "installed", "I", false,
+		"Compare to the installed configuration ("+config.SourceIdent+")\n"+
+			"instead of the proposed configuration")
+	fset.StringVar(&a.output, "output", config.OutputEnv,
+		"Print the differences in `format` "+config.OutputEnv+" (by ident, like diff -u) or "+
+			config.OutputJSON)
+}
+
+// run compares two configurations by ident.
+//
+// By default, the installed configuration is compared to the proposed one,
+// i.e., the configuration that would be installed with the given flags.
+// Positional arguments replace the first (with two arguments)
+// and the second configuration, respectively.
+func (o *diffOpts) run(a *agent, args []string) error {
+	switch a.output {
+	case config.OutputEnv, "", config.OutputJSON:
+	default:
+		return fmt.Errorf("%w: --output=%q (expected %s or %s)",
+			status.ErrInvalidValue, a.output, config.OutputEnv, config.OutputJSON)
+	}
+	from, to, err := o.paths(a, args)
+	if err != nil {
+		return err
+	}
+	fromEnv, err := config.FileEnv(from)
+	if err != nil {
+		return fmt.Errorf("load Appium configuration: %w", err)
+	}
+	var toEnv config.Env
+	if to == proposedConfig {
+		if _, err = a.resolve(); err != nil {
+			return err
+		}
+		toEnv = a.cfg.Env
+	} else if toEnv, err = config.FileEnv(to); err != nil {
+		return fmt.Errorf("load Appium configuration: %w", err)
+	}
+	change := config.Diff(fromEnv, toEnv)
+	if a.output == config.OutputJSON {
+		return config.WriteDiffJSON(os.Stdout, from, to, change)
+	}
+	return config.WriteDiff(os.Stdout, from, to, change)
+}
+
+func (o *diffOpts) paths(a *agent, args []string) (from, to string, err error) {
+	if from, err = config.LookupSource(); err != nil {
+		return "", "", fmt.Errorf("find Appium configuration: %w", err)
+	}
+	to = proposedConfig
+	if a.installed {
+		to = from
+	}
+	if o.backup {
+		dir, lerr := config.LookupBackup(from)
+		if lerr != nil {
+			return "", "", fmt.Errorf("find Appium configuration backup: %w", lerr)
+		}
+		snap, ferr := config.FindBackup(from, dir, "")
+		if ferr != nil {
+			return "", "", fmt.Errorf("find Appium configuration backup: %w", ferr)
+		}
+		from = snap.Path
+	}
+	switch len(args) {
+	case 0:
+	case 1:
+		to = args[0]
+	default:
+		from, to = args[0], args[1]
+	}
+	return from, to, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/ardnew/appium-agent/appium"
+	"github.com/ardnew/appium-agent/command"
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// doctorTools lists the external commands used to build and run Appium.
+var doctorTools = []string{ //nolint:gochecknoglobals
+	"tmux", "xcrun", "xcodebuild", "appium",
+}
+
+type check struct {
+	name string
+	test func() error
+}
+
+func runDoctor(a *agent, _ []string) error {
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+
+	checks := []check{
+		{"Appium init script", func() error {
+			_, err := a.command()
+			return err
+		}},
+		{"configuration path (" + config.SourceIdent + ")", func() error {
+			_, err := config.LookupSource()
+			return err
+		}},
+		{"configuration", a.validate},
+		{"Appium config.json", func() error {
+			sch, err := appium.DefaultSchema()
+			if err != nil {
+				return err
+			}
+			doc, err := appium.ReadFile(command.AppiumdConfigJSON(a.cmd.Root()))
+			if err != nil {
+				return err
+			}
+			return sch.Check(doc)
+		}},
+	}
+	for _, tool := range doctorTools {
+		checks = append(checks, check{"command " + tool, func() error {
+			_, err := exec.LookPath(tool)
+			return err
+		}})
+	}
+
+	failed := false
+	for _, c := range checks {
+		if err := c.test(); err != nil {
+			failed = true
+			fmt.Printf("  FAIL  %s: %v\n", c.name, err)
+		} else {
+			fmt.Printf("  ok    %s\n", c.name)
+		}
+	}
+	if desc, err := a.status(); err != nil {
+		fmt.Printf("  --    %v\n", err)
+	} else {
+		fmt.Printf("  ok    %s\n", desc)
+	}
+	if failed {
+		return status.ErrCheckFailed
+	}
+	return nil
+}
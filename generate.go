@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/appium"
+	"github.com/ardnew/appium-agent/command"
+)
+
+type generateOpts struct {
+	validateOpts
+	path string
+}
+
+func (o *generateOpts) flags(a *agent, fset *flag.FlagSet) {
+	addConfigFlags(a, fset)
+	fset.StringVar(&o.path, "appium-config", command.AppiumdConfigJSON(a.cmd.Root()),
+		"`path` of the Appium config.json to update")
+	fset.StringVar(&o.schema, "schema", "",
+		"Validate against the JSON schema at `path` instead of the bundled schema")
+}
+
+func (o *generateOpts) run(a *agent, _ []string) error {
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+	sch, err := o.load()
+	if err != nil {
+		return fmt.Errorf("load Appium schema: %w", err)
+	}
+	if err = appium.Generate(o.path, command.AppiumdConfigLock(a.cmd.Root()), a.cfg, sch); err != nil {
+		return fmt.Errorf("generate Appium config.json: %w", err)
+	}
+	if a.verbose {
+		fmt.Printf("updated Appium configuration: %s\n", o.path)
+	}
+	return nil
+}
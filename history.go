@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ardnew/appium-agent/config"
+)
+
+// backups returns the installed configuration path and its backup directory.
+func backups() (source, dir string, err error) {
+	if source, err = config.LookupSource(); err != nil {
+		return "", "", fmt.Errorf("find Appium configuration: %w", err)
+	}
+	if dir, err = config.LookupBackup(source); err != nil {
+		return "", "", fmt.Errorf("find Appium configuration backup: %w", err)
+	}
+	return source, dir, nil
+}
+
+func runConfigHistory(a *agent, _ []string) error {
+	source, dir, err := backups()
+	if err != nil {
+		return err
+	}
+	snap, err := config.Backups(source, dir)
+	if err != nil {
+		return fmt.Errorf("list Appium configuration backups: %w", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0) //nolint:gomnd,mnd
+	fmt.Fprintln(tw, "ID\tGENERATED\tCOMMAND")
+	// List the most recent backup first.
+	for i := len(snap) - 1; i >= 0; i-- {
+		s := snap[i]
+		if a.verbose {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n\t%s\t\n", s.ID, s.Generated, s.Command, s.Path)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", s.ID, s.Generated, s.Command)
+		}
+	}
+	return tw.Flush()
+}
+
+func runConfigRollback(a *agent, args []string) error {
+	source, dir, err := backups()
+	if err != nil {
+		return err
+	}
+	id := ""
+	if len(args) > 0 {
+		id = args[0]
+	}
+	snap, err := config.FindBackup(source, dir, id)
+	if err != nil {
+		return fmt.Errorf("find Appium configuration backup: %w", err)
+	}
+	if err = config.Rollback(source, dir, snap, config.BackupRetention()); err != nil {
+		return fmt.Errorf("rollback Appium configuration: %w", err)
+	}
+	if a.verbose {
+		fmt.Printf("restored backup %s: %s\n", snap.ID, source)
+	}
+	return nil
+}
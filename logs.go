@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/command"
+	"github.com/ardnew/appium-agent/rotate"
+	"github.com/ardnew/appium-agent/status"
+)
+
+const followInterval = 250 * time.Millisecond
+
+type logsOpts struct {
+	lines   int
+	follow  bool
+	policy  rotate.Policy
+	maxSize int64
+}
+
+func (o *logsOpts) flags(a *agent, fset *flag.FlagSet) {
+	addScriptFlags(a, fset)
+	fset.IntVarP(&o.lines, "lines", "n", 20, //nolint:gomnd,mnd
+		"Print the last `count` lines (0 prints the entire log)")
+	fset.BoolVarP(&o.follow, "follow", "F", false,
+		"Continue printing lines as they are appended to the log")
+}
+
+func (o *logsOpts) run(a *agent, args []string) error {
+	path := command.AppiumdSessionLog(a.cmd.Root())
+	if len(args) > 0 {
+		var err error
+		if path, err = logPath(a.cmd.Root(), args[0]); err != nil {
+			return err
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path, err)
+	}
+	defer f.Close()
+	if err = tail(os.Stdout, f, o.lines); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrReadFile, path, err)
+	}
+	if o.follow {
+		return follow(os.Stdout, f)
+	}
+	return nil
+}
+
+func (o *logsOpts) rotateFlags(a *agent, fset *flag.FlagSet) {
+	addScriptFlags(a, fset)
+	addRotateFlags(&o.policy, fset)
+}
+
+// rotate rotates the named logs (default: all), regardless of whether Appium
+// is running; a running server continues writing to the rotated file.
+func (o *logsOpts) rotate(a *agent, args []string) error {
+	if err := o.policy.Validate(); err != nil {
+		return fmt.Errorf("--keep: %w", err)
+	}
+	if len(args) == 0 {
+		return rotateLogs(a.cmd.Root(), o.policy)
+	}
+	for _, name := range args {
+		path, err := logPath(a.cmd.Root(), name)
+		if err != nil {
+			return err
+		}
+		if err = rotate.File(path, o.policy); err != nil {
+			return fmt.Errorf("rotate %s log: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (o *logsOpts) appendFlags(a *agent, fset *flag.FlagSet) {
+	o.rotateFlags(a, fset)
+	fset.Int64Var(&o.maxSize, "log-max-size", defaultLogMaxSize,
+		"Rotate the log when it exceeds `MiB` megabytes (0 disables)")
+}
+
+// append copies standard input to the named log (default: session) and to
+// standard output, like tee(1), rotating the log whenever it exceeds
+// --log-max-size. Appium started in tmux writes its output through it.
+func (o *logsOpts) append(a *agent, args []string) error {
+	if err := o.policy.Validate(); err != nil {
+		return fmt.Errorf("--keep: %w", err)
+	}
+	path := command.AppiumdSessionLog(a.cmd.Root())
+	if len(args) > 0 {
+		var err error
+		if path, err = logPath(a.cmd.Root(), args[0]); err != nil {
+			return err
+		}
+	}
+	o.policy.MaxSize = o.maxSize << 20 //nolint:gomnd,mnd
+	w, err := rotate.Open(path, o.policy)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if _, err = io.Copy(io.MultiWriter(w, os.Stdout), os.Stdin); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, path, err)
+	}
+	return nil
+}
+
+func addRotateFlags(p *rotate.Policy, fset *flag.FlagSet) {
+	p.Keep = rotate.DefaultKeep
+	fset.StringVar(&p.Dir, "backup-dir", "",
+		"Move rotated logs into directory at `path` (default: \"backup\" next to each log)")
+	fset.IntVar(&p.Keep, "keep", p.Keep,
+		"Keep at most `count` rotated files of each log")
+	fset.DurationVar(&p.MaxAge, "max-age", 0,
+		"Remove rotated files older than `duration` (0 keeps them regardless of age)")
+	fset.BoolVar(&p.Compress, "compress", false,
+		"Compress rotated files with gzip")
+}
+
+// logPath returns the path of the log with the given name.
+func logPath(root, name string) (string, error) {
+	switch name {
+	case "session":
+		return command.AppiumdSessionLog(root), nil
+	case "driver":
+		return command.AppiumdDriverLog(root), nil
+	}
+	return "", fmt.Errorf("%w: logs %s", status.ErrCommandUndef, name)
+}
+
+// rotateLogs rotates both the session and driver logs.
+func rotateLogs(root string, p rotate.Policy) error {
+	for _, path := range []string{
+		command.AppiumdSessionLog(root),
+		command.AppiumdDriverLog(root),
+	} {
+		if err := rotate.File(path, p); err != nil {
+			return fmt.Errorf("rotate logs: %w", err)
+		}
+	}
+	return nil
+}
+
+// tail copies the last n lines of r to w, or all of r if n is not positive.
+func tail(w io.Writer, r io.Reader, n int) error {
+	if n <= 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	ring := make([]string, 0, n)
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		if len(ring) == n {
+			ring = ring[1:]
+		}
+		ring = append(ring, scan.Text())
+	}
+	for _, line := range ring {
+		fmt.Fprintln(w, line)
+	}
+	return scan.Err()
+}
+
+// follow copies everything appended to r onto w until interrupted.
+func follow(w io.Writer, r io.Reader) error {
+	buf := bufio.NewReader(r)
+	for {
+		line, err := buf.ReadString('\n')
+		fmt.Fprint(w, line)
+		switch {
+		case errors.Is(err, io.EOF):
+			time.Sleep(followInterval)
+		case err != nil:
+			return fmt.Errorf("%w: %w", status.ErrReadFile, err)
+		}
+	}
+}
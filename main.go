@@ -2,98 +2,55 @@ package main
 
 import (
 	"bufio"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"time"
 
-	flag "github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/ardnew/appium-agent/command"
 	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/rotate"
 	"github.com/ardnew/appium-agent/status"
+	"github.com/ardnew/appium-agent/supervisor"
 )
 
 var Version = "0.3.1"
 
+const stopPollInterval = 100 * time.Millisecond
+
 func main() {
-	var (
-		exe *exec.Cmd
-		err error
-	)
+	var err error
 	defer func(e *error) {
 		if *e != nil {
 			log.Fatalf("error: %v", *e)
 		}
 	}(&err)
 
-	cfg := new(config.Model)
-	cmd := new(command.Model)
-
-	if exe, err = initCommand(cmd); err == nil {
-		if err = initConfig(cfg, cmd); err == nil {
-			var tmpConfig string
-			if tmpConfig, err = parseFlags(cfg, cmd); err == nil {
-				exe.Env = exe.Environ()
-				if tmpConfig != "" {
-					export := fmt.Sprintf("%s=%s", command.AppiumdConfigIdent, tmpConfig)
-					fmt.Printf("NOTE: using temporary Appium configuration:\n\t%s\n", export)
-					exe.Env = append(exe.Env, export)
-				}
-				if cmd.SkipBuild {
-					exe.Env = append(exe.Env, fmt.Sprintf("%s=%s", command.RestartAppiumIdent, "true"))
-				}
-				if cmd.ForceRestart {
-					if err = command.KillAll(exe); err != nil {
-						err = fmt.Errorf("kill all Appium services: %w", err)
-					}
-				}
-				err = run(exe)
-			}
-		}
-	}
-}
-
-func initConfig(cfg *config.Model, cmd *command.Model) error {
-	if err := cfg.Init(cmd); err != nil {
-		return fmt.Errorf("initialize Appium configuration: %w", err)
-	}
-	return nil
-}
-
-func initCommand(cmd *command.Model) (*exec.Cmd, error) {
-	if err := cmd.Init(); err != nil {
-		return nil, fmt.Errorf("initialize Appium launch command: %w", err)
+	a := newAgent()
+	if err = a.init(); err == nil {
+		err = a.exec(verbs(a.bin), os.Args[1:])
 	}
-	sh, arg := cmd.Command()
-	return exec.Command(sh, arg...), nil
 }
 
-func parseFlags(cfg *config.Model, cmd *command.Model) (string, error) {
-	bin, err := os.Executable()
-	if err != nil {
-		bin = os.Args[0]
-	}
-	bin = filepath.Base(bin)
-
-	fset, verbose, dryRun, overwrite := makeFlagSet(bin, cfg, cmd)
-	if err = fset.Parse(os.Args[1:]); err != nil {
-		if errors.Is(err, flag.ErrHelp) {
-			os.Exit(0)
-		}
-		return "", fmt.Errorf("parse command line flags: %w", err)
-	}
+// resolve applies the parsed command-line flags and the current environment
+// to the Appium configuration.
+//
+// It returns true if any configuration parameter was given on the command-line,
+// including by --config-file or --profile.
+func (a *agent) resolve() (bool, error) {
+	cfg := a.cfg
 
 	// Determine if we are running with modified configuration.
 	//
 	// First, the flags were all initialized
 	// with default, hard-coded values
-	// in makeFlagSet() above.
+	// in addConfigFlags().
 	//
 	// Next, we identify which values were given via command-line flags
 	// and mark them as user-defined.
@@ -104,10 +61,35 @@ func parseFlags(cfg *config.Model, cmd *command.Model) (string, error) {
 	// Here, we override all configuration parameters
 	// that were defined via command-line flags
 	//  (and mark them accordingly with .UserDef = true).
-	modifyConfig := cfg.ApplyToFlags(fset.Visit, // only those that were set
-		func(v *config.Var) bool { v.UserDef = true; return true },
+	modifyConfig := cfg.ApplyToFlags(a.fset.Visit, // only those that were set
+		func(v *config.Var) bool {
+			v.UserDef = true
+			v.Define(config.SourceFlag, "--"+v.Flag)
+			return true
+		},
 	)
 
+	// Configuration layers and then files are applied to all parameters
+	// that were not defined via command-line flags.
+	layers, layered, err := cfg.LoadLayers(a.cmd.Root())
+	if err != nil {
+		return false, fmt.Errorf("load Appium configuration: %w", err)
+	}
+	if a.verbose {
+		for _, l := range layers {
+			fmt.Printf("loaded %s configuration layer: %s\n", l.Source, l.Path)
+		}
+	}
+	for _, path := range a.files {
+		if err := cfg.Env.LoadFile(path, config.SourceFile); err != nil {
+			return false, fmt.Errorf("load Appium configuration: %w", err)
+		}
+	}
+	// The init script reads only the installed configuration, so any value
+	// changed by a layer, and any configuration file given, must be written
+	// along with the flags.
+	modifyConfig = modifyConfig || layered || a.fset.Changed("config-file")
+
 	// Any operation that modifies flags based on a given command-line flag
 	// MUST set the UserDef flag to true on the given flag
 	// AND all collateral flags that were modified.
@@ -117,10 +99,19 @@ func parseFlags(cfg *config.Model, cmd *command.Model) (string, error) {
 		ptr, found := cfg.Env.Get(func(v *config.Var) bool {
 			return v.Flag == flag || v.PFlag == flag
 		})
-		if found && !ptr.UserDef {
-			mod(ptr)
-			ptr.UserDef = true // mark as user-defined
+		if !found {
+			return
 		}
+		if ptr.UserDef {
+			// Record the value that would have been derived.
+			derived := *ptr
+			mod(&derived)
+			ptr.Ignore(config.SourceDerived, "--debug-config", derived.String(), "")
+			return
+		}
+		mod(ptr)
+		ptr.UserDef = true // mark as user-defined
+		ptr.Define(config.SourceDerived, "--debug-config")
 	}
 	reset := func(str string) modVar {
 		return func(env *config.Var) {
@@ -148,31 +139,139 @@ func parseFlags(cfg *config.Model, cmd *command.Model) (string, error) {
 	// found in the environment that were not already set via command-line flags.
 	cfg.Env = cfg.Env.Override(cfg.Orphan, cfg.Zero)
 
-	if *dryRun {
+	// A profile is applied after the environment, so that only the
+	// command-line flags take precedence over it.
+	if a.profile != "" {
+		modifyConfig = true
+		source, err := config.LookupSource()
+		if err != nil {
+			return false, fmt.Errorf("find Appium configuration: %w", err)
+		}
+		path, err := config.LookupProfile(source, a.profile)
+		if err != nil {
+			return false, fmt.Errorf("find Appium configuration profile: %w", err)
+		}
+		if err = cfg.Env.LoadFile(path, config.SourceProfile); err != nil {
+			return false, fmt.Errorf("load Appium configuration profile: %w", err)
+		}
+	}
+
+	// Capabilities given with --cap are merged into the capabilities parameter
+	// from any source, so that they are written along with the configuration.
+	if len(a.caps) > 0 {
+		if err := a.mergeCaps(); err != nil {
+			return false, err
+		}
+		modifyConfig = true
+	}
+
+	return modifyConfig, nil
+}
+
+// mergeCaps merges each --cap name=value into the capabilities parameter.
+func (a *agent) mergeCaps() error {
+	v, ok := a.cfg.Env.Lookup("appium_caps")
+	if !ok {
+		return fmt.Errorf("%w: %q", status.ErrIdentUndef, "appium_caps")
+	}
+	caps := map[string]any{}
+	if s := v.String(); s != "" {
+		if err := json.Unmarshal([]byte(s), &caps); err != nil {
+			return fmt.Errorf("%w: --%s: %w", status.ErrInvalidJSON, v.Flag, err)
+		}
+	}
+	for _, c := range a.caps {
+		name, val, err := config.ParseCapability(c)
+		if err != nil {
+			return fmt.Errorf("--cap: %w", err)
+		}
+		caps[name] = val
+	}
+	b, err := json.Marshal(caps)
+	if err != nil {
+		return fmt.Errorf("%w: --cap: %w", status.ErrInvalidValue, err)
+	}
+	if err = v.Set(string(b)); err != nil {
+		return fmt.Errorf("%w: --cap: %w", status.ErrInvalidValue, err)
+	}
+	v.UserDef = true
+	v.Define(config.SourceFlag, "--cap")
+	return nil
+}
+
+func (a *agent) validate() error {
+	if err := a.cfg.Validate(); err != nil {
+		return fmt.Errorf("validate Appium configuration: %w", err)
+	}
+	if _, err := a.listenAddress(); err != nil {
+		return fmt.Errorf("validate Appium configuration: %w", err)
+	}
+	if err := a.checkDevice(); err != nil {
+		return fmt.Errorf("validate Appium configuration: %w", err)
+	}
+	return nil
+}
+
+func runStart(a *agent, _ []string) error {
+	modifyConfig, err := a.resolve()
+	if err != nil {
+		return err
+	}
+
+	if a.dryRun {
 		// Print configuration and launch command to stdout, then exit.
-		if err = writeConfig(os.Stdout, cfg, cmd); err != nil {
-			return "", fmt.Errorf("generate Appium configuration: %w", err)
+		if err := writeConfig(os.Stdout, a.output, a.format, a.cfg, a.cmd); err != nil {
+			return fmt.Errorf("generate Appium configuration: %w", err)
 		}
-		os.Exit(0)
+		return nil
 	}
 
-	if err = cfg.Validate(); err != nil {
-		return "", fmt.Errorf("validate Appium configuration: %w", err)
+	// The init script would start a second Appium in tmux alongside the one
+	// run by the supervisor, which owns its ports and logs (restart stops it).
+	if st, ok := supervisor.Active(command.AppiumdStateFile(a.cmd.Root())); ok && !a.cmd.ForceRestart {
+		return fmt.Errorf("%w: Appium is %s under supervisor (pid %d); stop it first",
+			status.ErrAlreadyRunning, st.Phase, st.PID)
+	}
+
+	if err = a.validate(); err != nil {
+		return err
+	}
+
+	exe, err := a.command()
+	if err != nil {
+		return err
+	}
+
+	if a.cmd.ForceRestart {
+		if _, err = a.stopAll(); err != nil {
+			return err
+		}
+	}
+	// If Appium is not already running, it will be started with a new session,
+	// so check that its ports are available (or replace them with --auto-port).
+	_, serr := a.status()
+	fresh := serr != nil
+	if fresh {
+		changed, perr := a.checkPorts()
+		if perr != nil {
+			return perr
+		}
+		modifyConfig = modifyConfig || changed
 	}
 
 	var tmpConfig string
 	if modifyConfig {
-		if *overwrite {
+		if a.overwrite {
 			// Backup and write config to default file path
 			//  (tee to stdout if --verbose flag is set).
-			if err = install(cfg, cmd, *verbose, os.Stdout); err != nil {
-				return "", fmt.Errorf("install Appium configuration: %w", err)
+			if err = install(a.cfg, a.cmd, a.verbose, os.Stdout); err != nil {
+				return fmt.Errorf("install Appium configuration: %w", err)
 			}
 		} else {
 			// Write config to a temporary file without backup
 			//  (tee to stdout if --verbose flag is set).
-			if tmpConfig, err = scratch(cfg, cmd, bin, *verbose, os.Stdout); err != nil {
-				return "", fmt.Errorf("install Appium configuration (temp): %w", err)
+			if tmpConfig, err = scratch(a.cfg, a.cmd, a.bin, a.verbose, os.Stdout); err != nil {
+				return fmt.Errorf("install Appium configuration (temp): %w", err)
 			}
 		}
 	}
@@ -180,82 +279,229 @@ func parseFlags(cfg *config.Model, cmd *command.Model) (string, error) {
 	// tmpConfig is defined only if the user has overridden a config parameter
 	// but is NOT saving the configuration to the default config file.
 	// This allows for one-off test runs without committing anything to disk.
-	return tmpConfig, nil
+	exe.Env = exe.Environ()
+	if abs, xerr := os.Executable(); xerr == nil {
+		exe.Env = append(exe.Env, fmt.Sprintf("%s=%s", command.AgentExecIdent, abs))
+	}
+	if tmpConfig != "" {
+		export := fmt.Sprintf("%s=%s", command.AppiumdConfigIdent, tmpConfig)
+		fmt.Printf("NOTE: using temporary Appium configuration:\n\t%s\n", export)
+		exe.Env = append(exe.Env, export)
+	}
+	if a.cmd.SkipBuild {
+		exe.Env = append(exe.Env, fmt.Sprintf("%s=%s", command.RestartAppiumIdent, "true"))
+	}
+	if fresh {
+		// Begin the new session with fresh logs.
+		if err = rotateLogs(a.cmd.Root(), rotate.Policy{Keep: rotate.DefaultKeep}); err != nil {
+			return err
+		}
+	}
+	if err = run(exe); err != nil {
+		return err
+	}
+	if a.wait > 0 {
+		return a.waitReady()
+	}
+	return nil
 }
 
-func makeFlagSet(
-	bin string, cfg *config.Model, cmd *command.Model,
-) (fset *flag.FlagSet, verbose, dryRun, overwrite *bool) {
-	fset = flag.NewFlagSet(bin, flag.ContinueOnError)
-	verbose = new(bool)
-	dryRun = new(bool)
-	overwrite = new(bool)
-	fset.StringVarP(&cmd.ScriptPath, "appium-init", "i", cmd.ScriptPath,
-		"`path` to Appium init script")
-	fset.StringVarP(&cmd.ShellPath, "appium-init-shell", "e", cmd.ShellPath,
-		"`path` of shell to run Appium init script")
-	fset.BoolVarP(&cmd.ForceRestart, "kill-with-fire", "f", cmd.ForceRestart,
-		"Kill all running Appium services before starting")
-	fset.BoolVarP(&cmd.SkipBuild, "restart-appium", "r", cmd.SkipBuild,
-		"Restart Appium without building the target app or test driver")
-	fset.BoolVarP(&cfg.Debug, "debug-config", "g", false,
-		"Use the target debug configuration by default")
-	fset.BoolVarP(overwrite, "overwrite-config", "w", false,
-		"Write Appium configuration to file")
-	fset.BoolVarP(dryRun, "dryrun", "y", false,
-		"Print configuration and launch command")
-	fset.BoolVarP(&cfg.Orphan, "orphan", "j", false,
-		"Do not inherit configuration parameters from current environment\n"+
-			"(combine with -z to use command-line flags only)")
-	fset.BoolVarP(&cfg.Zero, "zero", "z", false,
-		"Do not initialize default configuration parameters\n"+
-			"(use command-line flags or environment variables only)")
-	fset.BoolVarP(verbose, "verbose", "v", false,
-		"Increase output verbosity")
-	opVar := []*config.Var{}
-	fset.VisitAll(func(f *flag.Flag) {
-		typ := config.ParseType(f.Value.Type())
-		val := f.Value.String()
-		opVar = append(opVar, config.NewVar(f.Name, f.Shorthand, "", typ, val, f.Usage))
-	})
-	for i := range cfg.Env {
-		f := fset.VarPF(
-			cfg.Env[i],
-			cfg.Env[i].Flag,
-			cfg.Env[i].PFlag,
-			strings.Join(cfg.Env[i].Comment, " "),
-		)
-		if cfg.Env[i].IsBoolFlag() {
-			f.NoOptDefVal = "true"
+func runStop(a *agent, _ []string) error {
+	stopped, err := a.stopAll()
+	if err == nil && !stopped && a.verbose {
+		fmt.Println("Appium is not running")
+	}
+	return err
+}
+
+// stopAll stops Appium whether it runs under the supervisor or in tmux.
+// It returns true if any running instance was found.
+func (a *agent) stopAll() (bool, error) {
+	stopped := false
+	if st, ok := supervisor.Active(command.AppiumdStateFile(a.cmd.Root())); ok {
+		stopped = true
+		if err := supervisor.Terminate(st.PID); err != nil {
+			return stopped, fmt.Errorf("stop Appium supervisor (pid %d): %w", st.PID, err)
+		}
+		deadline := time.Now().Add(supervisor.DefaultStopTimeout + time.Second)
+		for st.Alive() {
+			if time.Now().After(deadline) {
+				return stopped, fmt.Errorf("stop Appium supervisor (pid %d): timed out", st.PID)
+			}
+			time.Sleep(stopPollInterval)
+		}
+	}
+	if command.Exists() {
+		stopped = true
+		if err := command.KillAll(nil); err != nil {
+			return stopped, fmt.Errorf("kill all Appium services: %w", err)
+		}
+	}
+	return stopped, nil
+}
+
+func runRestart(a *agent, args []string) error {
+	a.cmd.ForceRestart = true
+	return runStart(a, args)
+}
+
+func runStatus(a *agent, _ []string) error {
+	desc, err := a.status()
+	if err != nil {
+		return err
+	}
+	fmt.Println(desc)
+	return nil
+}
+
+// status describes how Appium is running, under the supervisor or in tmux,
+// or returns an error wrapping status.ErrNotRunning.
+func (a *agent) status() (string, error) {
+	st, err := supervisor.ReadState(command.AppiumdStateFile(a.cmd.Root()))
+	switch {
+	case err == nil && st.Alive():
+		return fmt.Sprintf("Appium is %s under supervisor (pid %d, appium pid %d, restarts %d)",
+			st.Phase, st.PID, st.ChildPID, st.Restarts), nil
+	case command.Exists():
+		return fmt.Sprintf("Appium is running (tmux session %q)", command.AppiumdTmuxSession), nil
+	case err == nil && st.Phase == supervisor.CrashLoop:
+		return "", fmt.Errorf("%w: supervisor gave up after repeated crashes (restarts %d)",
+			status.ErrNotRunning, st.Restarts)
+	}
+	return "", status.ErrNotRunning
+}
+
+func runConfigShow(a *agent, _ []string) error {
+	if a.installed {
+		path, err := config.LookupSource()
+		if err != nil {
+			return fmt.Errorf("find Appium configuration: %w", err)
+		}
+		a.files = append(a.files, path)
+	}
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+	if err := writeConfig(os.Stdout, a.output, a.format, a.cfg, a.cmd); err != nil {
+		return fmt.Errorf("generate Appium configuration: %w", err)
+	}
+	return nil
+}
+
+// runConfigExplain prints where the value of each configuration parameter,
+// or only the one named by the argument (flag or ident), was defined.
+func runConfigExplain(a *agent, args []string) error {
+	if a.installed {
+		path, err := config.LookupSource()
+		if err != nil {
+			return fmt.Errorf("find Appium configuration: %w", err)
+		}
+		a.files = append(a.files, path)
+	}
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+	vars := a.cfg.Env
+	if len(args) > 0 {
+		name := strings.TrimLeft(args[0], "-")
+		v, ok := a.cfg.Env.Get(func(v *config.Var) bool {
+			return v.Flag == name || v.PFlag == name || v.Ident == name
+		})
+		if !ok {
+			return fmt.Errorf("%w: %q", status.ErrIdentUndef, args[0])
 		}
+		vars = config.Env{v}
 	}
-	fset.Usage = cfg.Env.Usage(bin, Version, opVar...)
-	return
+	switch a.output {
+	case config.OutputEnv, "":
+		return config.WriteExplain(os.Stdout, vars...)
+	case config.OutputJSON:
+		abs, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("absolute path of executable: %w", err)
+		}
+		sh, argv := a.cmd.Command()
+		r := (&config.Model{Env: vars, Zero: a.cfg.Zero}).Report(abs, append([]string{sh}, argv...))
+		return r.WriteJSON(os.Stdout)
+	}
+	return fmt.Errorf("%w: --output=%q (expected %s or %s)",
+		status.ErrInvalidValue, a.output, config.OutputEnv, config.OutputJSON)
 }
 
+// runConfigSet edits the installed configuration:
+// parameters not given on the command-line retain their installed values.
+func runConfigSet(a *agent, _ []string) error {
+	path, err := config.LookupSource()
+	if err != nil {
+		return fmt.Errorf("find Appium configuration: %w", err)
+	}
+	// Hold the lock from reading the installed configuration until it is
+	// replaced, so that concurrent edits cannot be lost.
+	lock, err := config.AcquireLock(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	if _, serr := os.Stat(path); serr == nil {
+		a.files = append(a.files, path)
+	}
+	modified, err := a.resolve()
+	if err != nil {
+		return err
+	}
+	if !modified {
+		return fmt.Errorf("%w: no configuration parameters given", status.ErrIdentUndef)
+	}
+	if err = a.validate(); err != nil {
+		return err
+	}
+	if err = replace(path, a.cfg, a.cmd, a.verbose, os.Stdout); err != nil {
+		return fmt.Errorf("install Appium configuration: %w", err)
+	}
+	return nil
+}
+
+func runConfigInstall(a *agent, _ []string) error {
+	if _, err := a.resolve(); err != nil {
+		return err
+	}
+	return runInstall(a)
+}
+
+func runInstall(a *agent) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if err := install(a.cfg, a.cmd, a.verbose, os.Stdout); err != nil {
+		return fmt.Errorf("install Appium configuration: %w", err)
+	}
+	return nil
+}
+
+// install backs up the installed configuration and then replaces it,
+// while holding the configuration's advisory lock.
 func install(cfg *config.Model, cmd *command.Model, tee bool, wTee ...io.Writer) error {
 	env, err := config.LookupSource()
 	if err != nil {
 		return fmt.Errorf("find Appium configuration: %w", err)
 	}
+	lock, err := config.AcquireLock(env)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	return replace(env, cfg, cmd, tee, wTee...)
+}
+
+// replace backs up the installed configuration at env and then replaces it.
+// The caller must hold the configuration's advisory lock.
+func replace(env string, cfg *config.Model, cmd *command.Model, tee bool, wTee ...io.Writer) error {
 	if bak, lerr := config.LookupBackup(env); lerr == nil {
-		if berr := config.Backup(env, bak); berr != nil {
+		if _, berr := config.Backup(env, bak, config.BackupRetention()); berr != nil {
 			return fmt.Errorf("backup Appium configuration: %w", berr)
 		}
 	}
-	out, err := os.OpenFile(env, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644) //nolint:gomnd,mnd
-	if err != nil {
-		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, env, err)
-	}
-	defer out.Close()
-	var wAll io.Writer = out
-	if tee && len(wTee) > 0 {
-		a := make([]io.Writer, 0, len(wTee)+1)
-		a = append(a, out)
-		a = append(a, wTee...)
-		wAll = io.MultiWriter(a...)
-	}
-	return writeConfig(wAll, cfg, cmd)
+	return config.WriteAtomic(env, 0o644, teeConfig(cfg, cmd, tee, wTee...)) //nolint:gomnd,mnd
 }
 
 func scratch(cfg *config.Model, cmd *command.Model, base string, tee bool, wTee ...io.Writer) (string, error) {
@@ -263,29 +509,44 @@ func scratch(cfg *config.Model, cmd *command.Model, base string, tee bool, wTee
 	if err != nil {
 		return "", fmt.Errorf("resolve temporary Appium configuration: %w", err)
 	}
-	out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644) //nolint:gomnd,mnd
-	if err != nil {
-		return "", fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path, err)
-	}
-	defer out.Close()
-	var wAll io.Writer = out
-	if tee && len(wTee) > 0 {
-		a := make([]io.Writer, 0, len(wTee)+1)
-		a = append(a, out)
-		a = append(a, wTee...)
-		wAll = io.MultiWriter(a...)
+	return path, config.WriteLocked(path, 0o644, teeConfig(cfg, cmd, tee, wTee...)) //nolint:gomnd,mnd
+}
+
+// teeConfig returns a func writing the configuration to its given writer,
+// and also to wTee if tee is true.
+func teeConfig(cfg *config.Model, cmd *command.Model, tee bool, wTee ...io.Writer) func(io.Writer) error {
+	return func(out io.Writer) error {
+		wAll := out
+		if tee && len(wTee) > 0 {
+			a := make([]io.Writer, 0, len(wTee)+1)
+			a = append(a, out)
+			a = append(a, wTee...)
+			wAll = io.MultiWriter(a...)
+		}
+		return writeConfig(wAll, config.OutputEnv, config.FormatPOSIX.String(), cfg, cmd)
 	}
-	return path, writeConfig(wAll, cfg, cmd)
 }
 
-func writeConfig(out io.Writer, cfg *config.Model, cmd *command.Model) error {
+func writeConfig(out io.Writer, output, format string, cfg *config.Model, cmd *command.Model) error {
 	abs, err := os.Executable()
 	if err != nil {
 		return fmt.Errorf("absolute path of executable: %w", err)
 	}
 	sh, args := cmd.Command()
-	if err = cfg.Write(
-		out,
+	switch output {
+	case config.OutputEnv, "":
+	case config.OutputJSON:
+		return cfg.Report(abs, append([]string{sh}, args...)).WriteJSON(out)
+	default:
+		return fmt.Errorf("%w: --output=%q (expected %s or %s)",
+			status.ErrInvalidValue, output, config.OutputEnv, config.OutputJSON)
+	}
+	f, err := config.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if err = cfg.WriteFormat(
+		out, f,
 		fmt.Sprintf("# Use command to start Appium:\n#   %s\n", abs),
 		fmt.Sprintf("#\n# (invokes: %q)\n\n", append([]string{sh}, args...)),
 	); err != nil {
@@ -0,0 +1,85 @@
+package netif
+
+// Standalone functions (non-methods) supporting type Interface.
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Interfaces returns the network interfaces of the host.
+func Interfaces() ([]Interface, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("list network interfaces: %w", err)
+	}
+	out := make([]Interface, 0, len(ifs))
+	for _, ifi := range ifs {
+		i := Interface{Name: ifi.Name, Up: ifi.Flags&net.FlagUp != 0}
+		addrs, aerr := ifi.Addrs()
+		if aerr != nil {
+			return nil, fmt.Errorf("list addresses of %s: %w", ifi.Name, aerr)
+		}
+		for _, addr := range addrs {
+			if ipn, ok := addr.(*net.IPNet); ok {
+				i.Addrs = append(i.Addrs, ipn.IP)
+			}
+		}
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+// Resolve returns the address selected by spec from the given interfaces.
+//
+// The spec is either a literal IP address (returned as is), a network in CIDR
+// notation (e.g., "10.0.0.0/8") matching an address of any interface that is
+// up, or the name of an interface that is up (e.g., "en5"). IPv4 addresses are
+// preferred; IPv6 addresses are considered only if ipv6 is true.
+func Resolve(ifs []Interface, spec string, ipv6 bool) (net.IP, error) {
+	spec = strings.TrimSpace(spec)
+	if ip := net.ParseIP(spec); ip != nil {
+		if ip.To4() == nil && !ipv6 {
+			return nil, fmt.Errorf("%w: %q: IPv6 is not enabled", status.ErrInvalidInterface, spec)
+		}
+		return ip, nil
+	}
+	if _, ipn, err := net.ParseCIDR(spec); err == nil {
+		for _, i := range ifs {
+			if ip := i.usable(ipv6, ipn); ip != nil {
+				return ip, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: no interface has an address in %s; candidates:\n%s",
+			status.ErrInvalidInterface, spec, candidates(ifs))
+	}
+	for _, i := range ifs {
+		if i.Name != spec {
+			continue
+		}
+		if ip := i.usable(ipv6, nil); ip != nil {
+			return ip, nil
+		}
+		return nil, fmt.Errorf("%w: %s has no usable address; candidates:\n%s",
+			status.ErrInvalidInterface, i, candidates(ifs))
+	}
+	return nil, fmt.Errorf("%w: %q is not an IP address, network or interface; candidates:\n%s",
+		status.ErrInvalidInterface, spec, candidates(ifs))
+}
+
+// candidates describes the interfaces that are up and have an address.
+func candidates(ifs []Interface) string {
+	var lines []string
+	for _, i := range ifs {
+		if i.Up && len(i.Addrs) > 0 {
+			lines = append(lines, "\t"+i.String())
+		}
+	}
+	if len(lines) == 0 {
+		return "\t(none)"
+	}
+	return strings.Join(lines, "\n")
+}
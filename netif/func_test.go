@@ -0,0 +1,101 @@
+package netif
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+func ips(s ...string) []net.IP {
+	out := make([]net.IP, len(s))
+	for i, a := range s {
+		out[i] = net.ParseIP(a)
+	}
+	return out
+}
+
+func TestResolve(t *testing.T) {
+	ifs := []Interface{
+		{Name: "lo0", Up: true, Addrs: ips("127.0.0.1", "::1")},
+		{Name: "en0", Up: true, Addrs: ips("fe80::1", "2001:db8::10", "192.168.1.10")},
+		{Name: "en5", Up: true, Addrs: ips("fe80::5", "2001:db8::5")},
+		{Name: "en6", Up: true, Addrs: ips("fe80::6")},
+		{Name: "en7", Up: false, Addrs: ips("10.0.0.7")},
+		{Name: "utun0", Up: true},
+	}
+	tests := []struct {
+		name string
+		spec string
+		ipv6 bool
+		want string // address, or "" if an error is expected
+	}{
+		{"interface", "en0", false, "192.168.1.10"},
+		{"interface prefers IPv4", "en0", true, "192.168.1.10"},
+		{"interface IPv6", "en5", true, "2001:db8::5"},
+		{"interface IPv6 disabled", "en5", false, ""},
+		{"interface link-local only", "en6", true, ""},
+		{"interface down", "en7", false, ""},
+		{"interface without address", "utun0", true, ""},
+		{"interface trimmed", " en0\n", false, "192.168.1.10"},
+		{"unknown interface", "en9", false, ""},
+		{"literal IPv4", "0.0.0.0", false, "0.0.0.0"},
+		{"literal IPv4 not on any interface", "172.16.0.1", false, "172.16.0.1"},
+		{"literal IPv6", "::", true, "::"},
+		{"literal IPv6 disabled", "::", false, ""},
+		{"CIDR", "192.168.0.0/16", false, "192.168.1.10"},
+		{"CIDR loopback", "127.0.0.0/8", false, "127.0.0.1"},
+		{"CIDR IPv6", "2001:db8::/32", true, "2001:db8::10"},
+		{"CIDR IPv6 disabled", "2001:db8::/32", false, ""},
+		{"CIDR only on interface down", "10.0.0.0/8", false, ""},
+		{"CIDR without match", "172.16.0.0/12", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := Resolve(ifs, tt.spec, tt.ipv6)
+			if tt.want == "" {
+				if !errors.Is(err, status.ErrInvalidInterface) {
+					t.Errorf("Resolve(%q, %v) = %v, %v; want %v", tt.spec, tt.ipv6, ip, err, status.ErrInvalidInterface)
+				}
+				return
+			}
+			if err != nil || !ip.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("Resolve(%q, %v) = %v, %v; want %s", tt.spec, tt.ipv6, ip, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestResolveCandidates checks that an error lists each interface that is up
+// and has an address, and only those.
+func TestResolveCandidates(t *testing.T) {
+	ifs := []Interface{
+		{Name: "lo0", Up: true, Addrs: ips("127.0.0.1")},
+		{Name: "en0", Up: true, Addrs: ips("192.168.1.10", "fe80::1")},
+		{Name: "en7", Up: false, Addrs: ips("10.0.0.7")},
+		{Name: "utun0", Up: true},
+	}
+	for _, spec := range []string{"en9", "en7", "10.0.0.0/8"} {
+		_, err := Resolve(ifs, spec, false)
+		if err == nil {
+			t.Fatalf("Resolve(%q) succeeded", spec)
+		}
+		msg := err.Error()
+		for _, want := range []string{"\tlo0 (up: 127.0.0.1)", "\ten0 (up: 192.168.1.10, fe80::1)"} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("Resolve(%q) error does not list %q:\n%s", spec, want, msg)
+			}
+		}
+		for _, unwanted := range []string{"\ten7", "\tutun0"} {
+			if strings.Contains(msg, unwanted) {
+				t.Errorf("Resolve(%q) error lists %q:\n%s", spec, unwanted, msg)
+			}
+		}
+	}
+	_, err := Resolve(nil, "en0", false)
+	if err == nil || !strings.HasSuffix(err.Error(), "candidates:\n\t(none)") {
+		t.Errorf("Resolve(no interfaces) = %v, want no candidates", err)
+	}
+}
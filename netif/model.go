@@ -0,0 +1,50 @@
+package netif
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Interface is a network interface and its addresses.
+type Interface struct {
+	Name  string
+	Up    bool
+	Addrs []net.IP
+}
+
+func (i Interface) String() string {
+	state := "down"
+	if i.Up {
+		state = "up"
+	}
+	addrs := make([]string, len(i.Addrs))
+	for j, ip := range i.Addrs {
+		addrs[j] = ip.String()
+	}
+	if len(addrs) == 0 {
+		addrs = append(addrs, "no address")
+	}
+	return fmt.Sprintf("%s (%s: %s)", i.Name, state, strings.Join(addrs, ", "))
+}
+
+// usable returns the first address of the interface that Appium can listen on:
+// IPv4 addresses are preferred, followed by global IPv6 addresses if allowed.
+func (i Interface) usable(ipv6 bool, in *net.IPNet) net.IP {
+	if !i.Up {
+		return nil
+	}
+	var v6 net.IP
+	for _, ip := range i.Addrs {
+		if in != nil && !in.Contains(ip) {
+			continue
+		}
+		if ip.To4() != nil {
+			return ip
+		}
+		if ipv6 && v6 == nil && !ip.IsLinkLocalUnicast() {
+			v6 = ip
+		}
+	}
+	return v6
+}
@@ -0,0 +1,41 @@
+package netif
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// PortSearchRange is the number of ports following a requested port that
+// FreePort considers.
+const PortSearchRange = 100
+
+// CheckPort returns an error wrapping status.ErrPortInUse if a TCP listener
+// cannot be bound to port on ip.
+func CheckPort(ip net.IP, port int) error {
+	ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", status.ErrPortInUse,
+			net.JoinHostPort(ip.String(), strconv.Itoa(port)), errors.Unwrap(err))
+	}
+	return ln.Close()
+}
+
+// FreePort returns the first port from port onward that can be bound on ip,
+// skipping the ports in exclude.
+func FreePort(ip net.IP, port int, exclude ...int) (int, error) {
+	for p := port; p < port+PortSearchRange && p <= 65535; p++ {
+		if slices.Contains(exclude, p) {
+			continue
+		}
+		if CheckPort(ip, p) == nil {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no free port in %d-%d on %s",
+		status.ErrPortInUse, port, port+PortSearchRange-1, ip)
+}
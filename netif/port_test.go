@@ -0,0 +1,67 @@
+package netif
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+var loopback = net.IPv4(127, 0, 0, 1) //nolint:gochecknoglobals
+
+// listen binds a TCP listener on a free port of the loopback address.
+func listen(t *testing.T) (net.Listener, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestCheckPort(t *testing.T) {
+	ln, port := listen(t)
+	if err := CheckPort(loopback, port); !errors.Is(err, status.ErrPortInUse) {
+		t.Errorf("CheckPort(busy) = %v, want %v", err, status.ErrPortInUse)
+	}
+	ln.Close()
+	if err := CheckPort(loopback, port); err != nil {
+		t.Errorf("CheckPort(free) = %v", err)
+	}
+	// The port is released again after it is checked.
+	if err := CheckPort(loopback, port); err != nil {
+		t.Errorf("CheckPort(checked) = %v", err)
+	}
+}
+
+func TestFreePort(t *testing.T) {
+	_, busy := listen(t)
+	got, err := FreePort(loopback, busy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got <= busy || got >= busy+PortSearchRange {
+		t.Errorf("FreePort(%d) = %d, want a port in %d-%d", busy, got, busy+1, busy+PortSearchRange-1)
+	}
+	exclude := []int{got, got + 1}
+	again, err := FreePort(loopback, busy, exclude...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == busy || slices.Contains(exclude, again) {
+		t.Errorf("FreePort(%d, %v) = %d, want a port neither busy nor excluded", busy, exclude, again)
+	}
+	if err = CheckPort(loopback, again); err != nil {
+		t.Errorf("FreePort() returned a port in use: %v", err)
+	}
+}
+
+func TestFreePortExhausted(t *testing.T) {
+	// The search ends at the last TCP port.
+	if _, err := FreePort(loopback, 65535, 65535); !errors.Is(err, status.ErrPortInUse) {
+		t.Errorf("FreePort(65535, 65535) = %v, want %v", err, status.ErrPortInUse)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ardnew/appium-agent/appium"
+	"github.com/ardnew/appium-agent/command"
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/netif"
+	"github.com/ardnew/appium-agent/status"
+	"github.com/ardnew/appium-agent/supervisor"
+)
+
+// identifyTimeout limits the time spent asking a port's owner to identify itself.
+const identifyTimeout = 2 * time.Second
+
+// checkPorts verifies that listen-port and wda-port differ and can both be
+// bound on the listen address, identifying the owner of any port in use.
+//
+// With --auto-port, conflicting ports are instead replaced with free ones,
+// and checkPorts reports whether the configuration was modified.
+func (a *agent) checkPorts() (bool, error) {
+	addr, err := a.listenAddress()
+	if err != nil {
+		return false, err
+	}
+	ip := net.ParseIP(addr)
+	var vars []*config.Var
+	for _, ident := range []string{"listen_port", "driver_port"} {
+		if v, ok := a.cfg.Env.Lookup(ident); ok && v.String() != "" {
+			vars = append(vars, v)
+		}
+	}
+	ports := make([]int, len(vars))
+	for i, v := range vars {
+		if ports[i], err = strconv.Atoi(v.String()); err != nil {
+			return false, fmt.Errorf("%w: %s=%q", status.ErrInvalidValue, v.Ident, v.String())
+		}
+	}
+
+	var (
+		errs     []error
+		modified bool
+	)
+	for i, v := range vars {
+		var cerr error
+		if i > 0 && ports[i] == ports[0] {
+			cerr = fmt.Errorf("%w: --%s and --%s are both %d",
+				status.ErrPortInUse, vars[0].Flag, v.Flag, ports[i])
+		} else if cerr = netif.CheckPort(ip, ports[i]); cerr != nil {
+			cerr = fmt.Errorf("--%s: %w (held by %s)", v.Flag, cerr, a.portOwner(addr, ports[i]))
+		}
+		if cerr == nil {
+			continue
+		}
+		if !a.autoPort {
+			errs = append(errs, cerr)
+			continue
+		}
+		free, ferr := netif.FreePort(ip, ports[i]+1, ports...)
+		if ferr != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", v.Flag, ferr))
+			continue
+		}
+		fmt.Printf("NOTE: %v; using --%s=%d\n", cerr, v.Flag, free)
+		if err = v.Set(strconv.Itoa(free)); err != nil {
+			return false, err
+		}
+		v.UserDef = true
+		v.Define(config.SourceFlag, "--auto-port")
+		ports[i], modified = free, true
+	}
+	return modified, errors.Join(errs...)
+}
+
+// portOwner describes the process listening on port, where possible.
+func (a *agent) portOwner(addr string, port int) string {
+	root := a.cmd.Root()
+	if st, err := supervisor.ReadState(command.AppiumdStateFile(root)); err == nil && st.ChildAlive() {
+		return fmt.Sprintf("Appium (pid %d) started by appium-agent daemon (pid %d)",
+			st.ChildPID, st.PID)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), identifyTimeout)
+	defer cancel()
+	desc, ok := appium.Identify(ctx, &http.Client{Timeout: identifyTimeout}, appium.StatusURL(addr, port))
+	switch {
+	case ok && command.Exists():
+		return fmt.Sprintf("%s, likely in tmux session %q", desc, command.AppiumdTmuxSession)
+	case ok:
+		return desc
+	}
+	return "an unknown process"
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// portAgent returns an agent listening on the loopback address with the
+// given Appium and WebDriverAgent ports.
+func portAgent(t *testing.T, listenPort, driverPort int) *agent {
+	t.Helper()
+	t.Setenv("FSDS_PREFIX", t.TempDir()) // no supervisor state
+	a := newAgent()
+	if err := a.init(); err != nil {
+		t.Fatal(err)
+	}
+	for ident, value := range map[string]string{
+		"listen_name": "127.0.0.1",
+		"listen_port": strconv.Itoa(listenPort),
+		"driver_port": strconv.Itoa(driverPort),
+	} {
+		v, _ := a.cfg.Env.Lookup(ident)
+		if err := v.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return a
+}
+
+// freePort returns a port that is free on the loopback address.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, port := busyPort(t, nil)
+	ln.Close()
+	return port
+}
+
+// busyPort binds a port on the loopback address, serving HTTP requests
+// with handler, if not nil.
+func busyPort(t *testing.T, handler http.Handler) (net.Listener, int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	if handler != nil {
+		go func() { _ = http.Serve(ln, handler) }()
+	}
+	return ln, ln.Addr().(*net.TCPAddr).Port
+}
+
+func port(t *testing.T, a *agent, ident string) int {
+	t.Helper()
+	v, _ := a.cfg.Env.Lookup(ident)
+	n, err := strconv.Atoi(v.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCheckPorts(t *testing.T) {
+	a := portAgent(t, freePort(t), freePort(t))
+	if modified, err := a.checkPorts(); err != nil || modified {
+		t.Errorf("checkPorts(free) = %v, %v; want unmodified", modified, err)
+	}
+}
+
+func TestCheckPortsSame(t *testing.T) {
+	p := freePort(t)
+	a := portAgent(t, p, p)
+	_, err := a.checkPorts()
+	if !errors.Is(err, status.ErrPortInUse) ||
+		!strings.Contains(err.Error(), "--listen-port and --wda-port are both "+strconv.Itoa(p)) {
+		t.Errorf("checkPorts(same) = %v, want %v naming both ports", err, status.ErrPortInUse)
+	}
+}
+
+func TestCheckPortsBusy(t *testing.T) {
+	// The owner of a busy port is identified by its /status endpoint.
+	_, p := busyPort(t, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `{"value":{"build":{"version":"2.11.0"}}}`)
+	}))
+	a := portAgent(t, p, freePort(t))
+	_, err := a.checkPorts()
+	if !errors.Is(err, status.ErrPortInUse) ||
+		!strings.Contains(err.Error(), "--listen-port: ") ||
+		!strings.Contains(err.Error(), "(held by Appium 2.11.0)") {
+		t.Errorf("checkPorts(busy) = %v, want %v held by Appium", err, status.ErrPortInUse)
+	}
+	if got := port(t, a, "listen_port"); got != p {
+		t.Errorf("listen_port = %d, want %d unchanged without --auto-port", got, p)
+	}
+}
+
+func TestCheckPortsAuto(t *testing.T) {
+	_, busy := busyPort(t, http.NotFoundHandler())
+	free := freePort(t)
+	tests := []struct {
+		name     string
+		listen   int
+		driver   int
+		replaced string // ident of the port replaced
+		was      int
+	}{
+		{"busy", busy, free, "listen_port", busy},
+		{"same", free, free, "driver_port", free},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := portAgent(t, tt.listen, tt.driver)
+			a.autoPort = true
+			modified, err := a.checkPorts()
+			if err != nil || !modified {
+				t.Fatalf("checkPorts() = %v, %v; want modified", modified, err)
+			}
+			listen, driver := port(t, a, "listen_port"), port(t, a, "driver_port")
+			if listen == driver || listen == busy {
+				t.Errorf("ports = %d, %d; want distinct free ports", listen, driver)
+			}
+			v, _ := a.cfg.Env.Lookup(tt.replaced)
+			got := port(t, a, tt.replaced)
+			if got <= tt.was || !v.UserDef || v.Source != config.SourceFlag {
+				t.Errorf("%s = %d (user %v, source %v); want a port after %d given by a flag",
+					tt.replaced, got, v.UserDef, v.Source, tt.was)
+			}
+			if from, _ := v.Winner(); !strings.Contains(from.String(), "--auto-port") {
+				t.Errorf("%s defined by %v, want --auto-port", tt.replaced, from)
+			}
+			// The replaced port is written into the installed configuration.
+			var out strings.Builder
+			if err = a.cfg.Write(&out); err != nil {
+				t.Fatal(err)
+			}
+			if want := "export " + tt.replaced + "=" + strconv.Itoa(got) + "\n"; !strings.Contains(out.String(), want) {
+				t.Errorf("configuration does not contain %q:\n%s", want, out.String())
+			}
+		})
+	}
+}
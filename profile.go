@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+type profileOpts struct {
+	force bool
+}
+
+func (o *profileOpts) flags(a *agent, fset *flag.FlagSet) {
+	addConfigFlags(a, fset)
+	fset.BoolVar(&o.force, "force", false,
+		"Replace the profile if it already exists")
+}
+
+// path returns the path of the profile named by the only positional argument.
+func (o *profileOpts) path(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("%w: expected exactly one profile name", status.ErrInvalidProfile)
+	}
+	source, err := config.LookupSource()
+	if err != nil {
+		return "", fmt.Errorf("find Appium configuration: %w", err)
+	}
+	return config.LookupProfile(source, args[0])
+}
+
+// save writes every parameter that was not defined by default or inherited
+// from the environment, i.e., those given by flags, files or another profile.
+func (o *profileOpts) save(a *agent, args []string) error {
+	path, err := o.path(args)
+	if err != nil {
+		return err
+	}
+	if _, err = a.resolve(); err != nil {
+		return err
+	}
+	if _, serr := os.Stat(path); serr == nil && !o.force {
+		return fmt.Errorf("%w: %q exists (use --force to replace)", status.ErrInvalidProfile, args[0])
+	}
+	prof := &config.Model{
+		EnvQuote: a.cfg.EnvQuote,
+		Env: config.Filter(slices.Values(a.cfg.Env), func(v *config.Var) bool {
+			return v.Source != config.SourceDefault && v.Source != config.SourceEnv &&
+				!v.Source.IsLayer()
+		}),
+	}
+	if len(prof.Env) == 0 {
+		return fmt.Errorf("%w: no configuration parameters given", status.ErrIdentUndef)
+	}
+	if err = config.WriteLocked(path, 0o644, func(w io.Writer) error { //nolint:gomnd,mnd
+		return prof.Write(w)
+	}); err != nil {
+		return fmt.Errorf("save Appium configuration profile: %w", err)
+	}
+	if a.verbose {
+		fmt.Printf("saved profile %q: %s\n", args[0], path)
+	}
+	return nil
+}
+
+func (o *profileOpts) list(a *agent, _ []string) error {
+	source, err := config.LookupSource()
+	if err != nil {
+		return fmt.Errorf("find Appium configuration: %w", err)
+	}
+	names, err := config.Profiles(source)
+	if err != nil {
+		return fmt.Errorf("list Appium configuration profiles: %w", err)
+	}
+	for _, name := range names {
+		if a.verbose {
+			path, _ := config.LookupProfile(source, name)
+			fmt.Printf("%s\t%s\n", name, path)
+		} else {
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
+
+func (o *profileOpts) delete(_ *agent, args []string) error {
+	path, err := o.path(args)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %q does not exist", status.ErrInvalidProfile, args[0])
+		}
+		return fmt.Errorf("delete Appium configuration profile: %w", err)
+	}
+	return nil
+}
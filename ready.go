@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ardnew/appium-agent/appium"
+	"github.com/ardnew/appium-agent/command"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// readyLogLines is the number of session log lines printed when Appium
+// does not become ready.
+const readyLogLines = 20
+
+// waitReady blocks until Appium's /status endpoint reports ready or a.wait
+// elapses. On failure, the tail of the session log is printed to stderr.
+func (a *agent) waitReady() error {
+	addr, err := a.listenAddress()
+	if err != nil {
+		return err
+	}
+	port, ok := a.cfg.Env.Lookup("listen_port")
+	if !ok {
+		return fmt.Errorf("%w: %q", status.ErrIdentUndef, "listen_port")
+	}
+	num, err := strconv.Atoi(port.String())
+	if err != nil {
+		return fmt.Errorf("%w: listen_port: %q", status.ErrInvalidValue, port.String())
+	}
+	url := appium.StatusURL(addr, num)
+	if a.verbose {
+		fmt.Printf("waiting up to %v for %s\n", a.wait, url)
+	}
+	if err = appium.WaitReady(context.Background(), url, a.wait); err != nil {
+		path := command.AppiumdSessionLog(a.cmd.Root())
+		if f, oerr := os.Open(path); oerr == nil {
+			fmt.Fprintf(os.Stderr, "==> %s <==\n", path)
+			_ = tail(os.Stderr, f, readyLogLines)
+			f.Close()
+		}
+		return fmt.Errorf("wait for Appium: %w", err)
+	}
+	if a.verbose {
+		fmt.Println("Appium is ready")
+	}
+	return nil
+}
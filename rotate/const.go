@@ -0,0 +1,7 @@
+package rotate
+
+const (
+	DefaultKeep = 10 // number of rotated files to keep for each log
+	TimeLayout  = "20060102-150405"
+	GzipExt     = ".gz"
+)
@@ -0,0 +1,155 @@
+package rotate
+
+// Standalone functions (non-methods) supporting type Policy.
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// File moves the log at path into the policy's backup directory with a
+// timestamp inserted into its name, e.g., "session.20240102-150405.log",
+// replaces it with a new, empty log, and then prunes old backups.
+//
+// Logs that do not exist or are empty are not rotated, but their backups are
+// still pruned.
+func File(path string, p Policy) error {
+	dir := p.dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gomnd,mnd
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, dir, err)
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.Size() > 0:
+		if err = move(path, dir, p.Compress); err != nil {
+			return err
+		}
+	case err != nil && !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%w: %q: %w", status.ErrReadFile, path, err)
+	}
+	// Replace it with a new, empty log file.
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644) //nolint:gomnd,mnd
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path, err)
+	}
+	f.Close()
+	return Prune(path, p)
+}
+
+// Prune removes the rotated backups of the log at path that exceed the
+// policy's retention count or age, oldest first.
+func Prune(path string, p Policy) error {
+	dir := p.dir(path)
+	prefix, suffix := splitName(path)
+	ent, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("%w: %q: %w", status.ErrReadFile, dir, err)
+	}
+	type backup struct {
+		path string
+		mod  time.Time
+	}
+	var all []backup
+	for _, e := range ent {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, prefix) ||
+			!strings.HasSuffix(strings.TrimSuffix(name, GzipExt), suffix) {
+			continue
+		}
+		info, ierr := e.Info()
+		if ierr != nil {
+			continue
+		}
+		all = append(all, backup{filepath.Join(dir, name), info.ModTime()})
+	}
+	// Sort by modification time, most recent first.
+	slices.SortFunc(all, func(a, b backup) int { return b.mod.Compare(a.mod) })
+	var errs []error
+	for i, b := range all {
+		expired := p.MaxAge > 0 && time.Since(b.mod) > p.MaxAge
+		if i < max(p.Keep, 1) && !expired {
+			continue
+		}
+		if rerr := os.Remove(b.path); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("%w: %q: %w", status.ErrWriteFile, b.path, rerr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// move renames the log into dir with a unique, timestamped name,
+// optionally compressing it.
+func move(path, dir string, compress bool) error {
+	prefix, suffix := splitName(path)
+	id := time.Now().Format(TimeLayout)
+	dest := filepath.Join(dir, prefix+id+suffix)
+	for n := 1; exists(dest) || exists(dest+GzipExt); n++ {
+		dest = filepath.Join(dir, prefix+id+"-"+strconv.Itoa(n)+suffix)
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return fmt.Errorf("%w: rotate: %q -> %q: %w", status.ErrWriteFile, path, dest, err)
+	}
+	if compress {
+		return gzipFile(dest)
+	}
+	return nil
+}
+
+// gzipFile replaces the file at path with its compressed form (path + ".gz").
+func gzipFile(path string) (err error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path, err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+GzipExt, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644) //nolint:gomnd,mnd
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, path+GzipExt, err)
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("%w: %q: %w", status.ErrWriteFile, out.Name(), cerr)
+		}
+		if err != nil {
+			_ = os.Remove(out.Name())
+		}
+	}()
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, out.Name(), err)
+	}
+	if err = zw.Close(); err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, out.Name(), err)
+	}
+	// Preserve the modification time used to order backups when pruning.
+	if info, serr := in.Stat(); serr == nil {
+		_ = os.Chtimes(out.Name(), info.ModTime(), info.ModTime())
+	}
+	return os.Remove(path)
+}
+
+// splitName splits the base name of a log around which a timestamp is
+// inserted, e.g., "session.log" yields "session." and ".log".
+func splitName(path string) (prefix, suffix string) {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + ".", ext
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,169 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeLog(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backups returns the names of the files in dir, sorted.
+func backups(t *testing.T, dir string) []string {
+	t.Helper()
+	ent, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range ent {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// backupAt creates a backup of session.log in dir modified at mod.
+func backupAt(t *testing.T, dir string, mod time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, "session."+mod.Format(TimeLayout)+".log")
+	writeLog(t, path, mod.String())
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Base(path)
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.log")
+	writeLog(t, path, "first\n")
+	if err := File(path, Policy{Keep: DefaultKeep}); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("log after rotation = %v, %v; want empty", info, err)
+	}
+	got := backups(t, filepath.Join(dir, "backup"))
+	if len(got) != 1 || !strings.HasPrefix(got[0], "session.") || !strings.HasSuffix(got[0], ".log") {
+		t.Fatalf("backups = %q, want one session.<time>.log", got)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "backup", got[0]))
+	if err != nil || string(b) != "first\n" {
+		t.Errorf("backup = %q, %v; want %q", b, err, "first\n")
+	}
+
+	// An empty log is not rotated, and a second rotation within the same
+	// second is given a unique name.
+	if err = File(path, Policy{Keep: DefaultKeep}); err != nil {
+		t.Fatal(err)
+	}
+	if got = backups(t, filepath.Join(dir, "backup")); len(got) != 1 {
+		t.Errorf("backups after rotating an empty log = %q, want 1", got)
+	}
+	writeLog(t, path, "second\n")
+	if err = File(path, Policy{Keep: DefaultKeep}); err != nil {
+		t.Fatal(err)
+	}
+	if got = backups(t, filepath.Join(dir, "backup")); len(got) != 2 || got[0] == got[1] {
+		t.Errorf("backups = %q, want 2 unique", got)
+	}
+}
+
+func TestFileMissing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "driver.log")
+	if err := File(path, Policy{Keep: DefaultKeep, Dir: filepath.Join(dir, "old")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("log not created: %v", err)
+	}
+	if got := backups(t, filepath.Join(dir, "old")); len(got) != 0 {
+		t.Errorf("backups = %q, want none", got)
+	}
+}
+
+func TestFileCompress(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.log")
+	writeLog(t, path, "compressed\n")
+	if err := File(path, Policy{Keep: DefaultKeep, Compress: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := backups(t, filepath.Join(dir, "backup"))
+	if len(got) != 1 || !strings.HasSuffix(got[0], ".log"+GzipExt) {
+		t.Fatalf("backups = %q, want one session.<time>.log%s", got, GzipExt)
+	}
+	f, err := os.Open(filepath.Join(dir, "backup", got[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, rerr := io.ReadAll(zr); rerr != nil || string(b) != "compressed\n" {
+		t.Errorf("decompressed backup = %q, %v; want %q", b, rerr, "compressed\n")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []int // ages (hours) of the backups kept
+	}{
+		{"count", Policy{Keep: 2}, []int{1, 2}},
+		{"age", Policy{Keep: DefaultKeep, MaxAge: 3*time.Hour + time.Minute}, []int{1, 2, 3}},
+		{"count and age", Policy{Keep: 2, MaxAge: 90 * time.Minute}, []int{1}},
+		{"at least 1", Policy{}, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "session.log")
+			bdir := filepath.Join(dir, "backup")
+			if err := os.Mkdir(bdir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			name := map[int]string{}
+			for _, age := range []int{1, 2, 3, 4, 5} {
+				name[age] = backupAt(t, bdir, now.Add(-time.Duration(age)*time.Hour))
+			}
+			// Backups of other logs are never removed.
+			writeLog(t, filepath.Join(bdir, "driver.20000101-000000.log"), "driver")
+			if err := Prune(path, tt.policy); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"driver.20000101-000000.log"}
+			for _, age := range tt.want {
+				want = append(want, name[age])
+			}
+			sort.Strings(want)
+			if got := backups(t, bdir); strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("backups = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for keep, valid := range map[int]bool{-1: false, 0: false, 1: true, DefaultKeep: true} {
+		if err := (Policy{Keep: keep}).Validate(); (err == nil) != valid {
+			t.Errorf("Policy{Keep: %d}.Validate() = %v, want valid %v", keep, err, valid)
+		}
+	}
+}
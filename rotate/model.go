@@ -0,0 +1,142 @@
+package rotate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Policy defines where rotated logs are kept and for how long.
+type Policy struct {
+	Dir      string        // backup directory (default: "backup" next to the log)
+	Keep     int           // maximum number of rotated files to keep per log (at least 1)
+	MaxAge   time.Duration // remove rotated files older than this (0 = never)
+	Compress bool          // gzip rotated files
+	MaxSize  int64         // rotate a Writer's log when it exceeds this size (0 = never)
+}
+
+// Validate returns an error if the policy would keep no rotated files.
+// Rotation always keeps the most recent backup, so that the log it replaced
+// is never lost.
+func (p Policy) Validate() error {
+	if p.Keep < 1 {
+		return fmt.Errorf("%w: keep %d: at least 1 rotated file is kept", status.ErrInvalidValue, p.Keep)
+	}
+	return nil
+}
+
+func (p Policy) dir(path string) string {
+	if p.Dir != "" {
+		return p.Dir
+	}
+	return filepath.Join(filepath.Dir(path), "backup")
+}
+
+// Writer appends to a log file, rotating it according to its policy
+// whenever a write would grow it beyond Policy.MaxSize.
+//
+// If the log cannot be reopened after it is rotated, the write fails, and
+// the log is reopened by the next write.
+type Writer struct {
+	mu     sync.Mutex
+	path   string
+	policy Policy
+	file   *os.File // nil if closed, or if the log could not be reopened
+	size   int64
+	closed bool
+}
+
+// Open returns a Writer appending to the log at path.
+func Open(path string, p Policy) (*Writer, error) {
+	w := &Writer{path: path, policy: p}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0o755); err != nil { //nolint:gomnd,mnd
+		return fmt.Errorf("%w: %q: %w", status.ErrWriteFile, w.path, err)
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gomnd,mnd
+	if err != nil {
+		return fmt.Errorf("%w: %q: %w", status.ErrOpenFile, w.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%w: %q: %w", status.ErrReadFile, w.path, err)
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.policy.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.policy.MaxSize {
+		// Continue writing to the log if it could not be rotated; rotation is
+		// retried by the next write that exceeds the limit.
+		if err := w.rotate(); w.file == nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate rotates the log immediately.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// rotate rotates the log and reopens it. The log is reopened even if it
+// could not be rotated, so that w.file is nil only if reopening failed.
+func (w *Writer) rotate() error {
+	var errs []error
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %q: %w", status.ErrWriteFile, w.path, err))
+		}
+		w.file = nil
+	}
+	if err := File(w.path, w.policy); err != nil {
+		errs = append(errs, err)
+	}
+	if err := w.open(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,101 @@
+package rotate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestWriterMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.log")
+	writeLog(t, path, "old\n") // appended to, not truncated
+	w, err := Open(path, Policy{Keep: DefaultKeep, MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, line := range []string{"one\n", "two\n", "three\n", "a line longer than the limit\n"} {
+		if n, werr := w.Write([]byte(line)); werr != nil || n != len(line) {
+			t.Fatalf("Write(%q) = %d, %v", line, n, werr)
+		}
+	}
+	// "two\n" would grow "old\none\n" beyond the limit, "three\n" fits after
+	// it, and a single write that exceeds the limit is never split.
+	if got, want := readLog(t, path), "a line longer than the limit\n"; got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+	var rotated []string
+	for _, name := range backups(t, filepath.Join(dir, "backup")) {
+		rotated = append(rotated, readLog(t, filepath.Join(dir, "backup", name)))
+	}
+	sort.Strings(rotated) // backups rotated within the same second are unordered
+	if got, want := strings.Join(rotated, "|"), "old\none\n|two\nthree\n"; got != want {
+		t.Errorf("rotated = %q, want %q", got, want)
+	}
+}
+
+func TestWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "session.log")
+	w, err := Open(path, Policy{Keep: DefaultKeep, Dir: filepath.Join(dir, "backup")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, err = w.Write([]byte("before\n")); err != nil {
+		t.Fatal(err)
+	}
+	// The log cannot be reopened while its directory is replaced by a file.
+	if err = os.Rename(filepath.Dir(path), filepath.Join(dir, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, filepath.Dir(path), "not a directory")
+	if err = w.Rotate(); err == nil {
+		t.Fatal("Rotate() succeeded without a log directory")
+	}
+	if _, err = w.Write([]byte("lost\n")); err == nil {
+		t.Fatal("Write() succeeded without a log directory")
+	}
+	// Once the directory is restored, the next write reopens the log.
+	if err = os.Remove(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("after\n")); err != nil {
+		t.Fatalf("Write() after restoring the log directory: %v", err)
+	}
+	if got := readLog(t, path); got != "after\n" {
+		t.Errorf("log = %q, want %q", got, "after\n")
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	w, err := Open(filepath.Join(t.TempDir(), "session.log"), Policy{Keep: DefaultKeep})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write() after Close() = %v, want %v", err, os.ErrClosed)
+	}
+	if err = w.Rotate(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Rotate() after Close() = %v, want %v", err, os.ErrClosed)
+	}
+}
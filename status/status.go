@@ -11,10 +11,22 @@ var (
 )
 
 var (
-	ErrInvalidConfig = errors.New("invalid configuration path")
-	ErrInvalidBackup = errors.New("invalid configuration backup path")
-	ErrIdentUndef    = errors.New("undefined configuration parameter")
-	ErrTypeUndef     = errors.New("undefined configuration type")
+	ErrInvalidConfig  = errors.New("invalid configuration path")
+	ErrInvalidBackup  = errors.New("invalid configuration backup path")
+	ErrIdentUndef     = errors.New("undefined configuration parameter")
+	ErrTypeUndef      = errors.New("undefined configuration type")
+	ErrInvalidValue   = errors.New("invalid configuration value")
+	ErrInvalidJSON    = errors.New("invalid JSON document")
+	ErrCommandSubst   = errors.New("command substitution failed")
+	ErrExecDenied     = errors.New("command substitution not allowed")
+	ErrParseEnv       = errors.New("invalid configuration syntax")
+	ErrInvalidProfile = errors.New("invalid configuration profile")
+	ErrLocked         = errors.New("configuration is locked")
+)
+
+var (
+	ErrInvalidSchema   = errors.New("invalid JSON schema")
+	ErrSchemaViolation = errors.New("configuration does not conform to Appium schema")
 )
 
 var (
@@ -22,3 +34,27 @@ var (
 	ErrInvalidScript = errors.New("invalid script path")
 	ErrInvalidShell  = errors.New("invalid shell path")
 )
+
+var (
+	ErrCommandUndef = errors.New("undefined command")
+	ErrNotRunning   = errors.New("service not running")
+	ErrCheckFailed  = errors.New("one or more checks failed")
+)
+
+var (
+	ErrAlreadyRunning = errors.New("supervisor already running")
+	ErrCrashLoop      = errors.New("crash loop detected")
+)
+
+var (
+	ErrNotReady     = errors.New("service not ready")
+	ErrWatchTimeout = errors.New("timed out waiting for pattern")
+	ErrWatchExited  = errors.New("command exited before pattern matched")
+	ErrWatchCancel  = errors.New("interrupted waiting for pattern")
+)
+
+var ErrInvalidDevice = errors.New("invalid target device")
+
+var ErrInvalidInterface = errors.New("invalid network interface")
+
+var ErrPortInUse = errors.New("port in use")
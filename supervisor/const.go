@@ -0,0 +1,23 @@
+package supervisor
+
+import "time"
+
+const (
+	DefaultMinBackoff  = 1 * time.Second
+	DefaultMaxBackoff  = 1 * time.Minute
+	DefaultCrashWindow = 2 * time.Minute
+	DefaultMaxCrashes  = 5
+	DefaultStopTimeout = 10 * time.Second
+)
+
+// Phase is the lifecycle state of the supervised process.
+type Phase string
+
+const (
+	Starting  Phase = "starting"
+	Running   Phase = "running"
+	Backoff   Phase = "backoff"   // waiting to restart after an exit
+	CrashLoop Phase = "crashloop" // gave up after repeated crashes
+	Stopping  Phase = "stopping"
+	Stopped   Phase = "stopped"
+)
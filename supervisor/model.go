@@ -0,0 +1,215 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Supervisor runs a command as a child process group,
+// restarting it with exponential backoff whenever it crashes.
+//
+// If the child crashes MaxCrashes times within CrashWindow,
+// the supervisor gives up (crash-loop detection).
+// A child that runs longer than CrashWindow resets the backoff.
+//
+// A child that exits with status 0 was shut down deliberately and did not
+// crash. The supervisor then stops, unless RestartClean is set.
+type Supervisor struct {
+	Path   string
+	Args   []string
+	Dir    string
+	Env    []string
+	Output io.Writer // receives both stdout and stderr of the child
+
+	StatePath string
+	PIDPath   string
+
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	CrashWindow time.Duration
+	MaxCrashes  int
+	StopTimeout time.Duration
+
+	// RestartClean restarts the child after it exits with status 0, after
+	// MinBackoff, without counting the exit as a crash.
+	RestartClean bool
+
+	state State
+}
+
+func (s *Supervisor) init() {
+	if s.MinBackoff <= 0 {
+		s.MinBackoff = DefaultMinBackoff
+	}
+	if s.MaxBackoff < s.MinBackoff {
+		s.MaxBackoff = max(DefaultMaxBackoff, s.MinBackoff)
+	}
+	if s.CrashWindow <= 0 {
+		s.CrashWindow = DefaultCrashWindow
+	}
+	if s.MaxCrashes <= 0 {
+		s.MaxCrashes = DefaultMaxCrashes
+	}
+	if s.StopTimeout <= 0 {
+		s.StopTimeout = DefaultStopTimeout
+	}
+	if s.Output == nil {
+		s.Output = io.Discard
+	}
+}
+
+// Run supervises the command until ctx is canceled,
+// which stops the child process group, until a crash loop is detected,
+// or until the child exits with status 0 (see RestartClean).
+func (s *Supervisor) Run(ctx context.Context) error {
+	s.init()
+	if err := writePIDFile(s.PIDPath); err != nil {
+		return err
+	}
+	defer removePIDFile(s.PIDPath)
+
+	s.state = State{PID: os.Getpid(), Command: append([]string{s.Path}, s.Args...)}
+	var crashes []time.Time
+	backoff := s.MinBackoff
+	for {
+		start := time.Now()
+		code, err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			s.setPhase(Stopped)
+			return nil
+		}
+		s.state.LastExit = &code
+		s.state.LastError = ""
+		if err != nil {
+			s.state.LastError = err.Error()
+		}
+
+		if code == 0 && err == nil {
+			if !s.RestartClean {
+				fmt.Fprintf(s.Output, "supervisor: %s exited (code 0); not restarting\n", s.Path)
+				s.setPhase(Stopped)
+				return nil
+			}
+			fmt.Fprintf(s.Output, "supervisor: %s exited (code 0); restarting in %v\n",
+				s.Path, s.MinBackoff)
+			if !s.wait(ctx, s.MinBackoff) {
+				return nil
+			}
+			s.state.Restarts++
+			continue
+		}
+
+		now := time.Now()
+		if now.Sub(start) >= s.CrashWindow {
+			crashes, backoff = nil, s.MinBackoff // child was stable
+		}
+		crashes = append(crashes, now)
+		for len(crashes) > 0 && now.Sub(crashes[0]) > s.CrashWindow {
+			crashes = crashes[1:]
+		}
+		if len(crashes) >= s.MaxCrashes {
+			s.setPhase(CrashLoop)
+			return fmt.Errorf("%w: %d crashes within %v (last exit code %d)",
+				status.ErrCrashLoop, len(crashes), s.CrashWindow, code)
+		}
+
+		fmt.Fprintf(s.Output, "supervisor: %s exited (code %d); restarting in %v\n",
+			s.Path, code, backoff)
+		if !s.wait(ctx, backoff) {
+			return nil
+		}
+		backoff = min(2*backoff, s.MaxBackoff)
+		s.state.Restarts++
+	}
+}
+
+// wait sleeps for the given delay before a restart, reporting false if ctx
+// is canceled first.
+func (s *Supervisor) wait(ctx context.Context, delay time.Duration) bool {
+	s.setPhase(Backoff)
+	select {
+	case <-ctx.Done():
+		s.setPhase(Stopped)
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// runOnce starts the child and waits for it to exit, returning its exit code.
+// If ctx is canceled first, the child's process group is stopped.
+func (s *Supervisor) runOnce(ctx context.Context) (int, error) {
+	s.setPhase(Starting)
+	out := &syncWriter{w: s.Output}
+	cmd := exec.Command(s.Path, s.Args...)
+	cmd.Dir, cmd.Env = s.Dir, s.Env
+	cmd.Stdout, cmd.Stderr = out, out
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("start %s: %w", s.Path, err)
+	}
+	s.state.ChildPID = cmd.Process.Pid
+	s.state.Started = time.Now()
+	s.setPhase(Running)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		s.setPhase(Stopping)
+		err = s.stop(cmd.Process.Pid, done)
+	}
+	s.state.ChildPID = 0
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// stop terminates the child's process group, escalating to SIGKILL
+// if it does not exit within StopTimeout.
+func (s *Supervisor) stop(pid int, done <-chan error) error {
+	_ = signalGroup(pid, syscall.SIGTERM)
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(s.StopTimeout):
+		_ = signalGroup(pid, syscall.SIGKILL)
+		return <-done
+	}
+}
+
+func (s *Supervisor) setPhase(p Phase) {
+	s.state.Phase = p
+	if err := writeState(s.StatePath, s.state); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: write supervisor state: %v\n", err)
+	}
+}
+
+// syncWriter serializes writes from the child's stdout and stderr.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
@@ -0,0 +1,256 @@
+//go:build unix
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// output collects the output of the supervisor and its child.
+type output struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.b.Write(p)
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.b.String()
+}
+
+// stub returns a supervisor of a child shell running script in a temporary
+// directory, which is also its working directory.
+func stub(t *testing.T, script string) (*Supervisor, *output) {
+	t.Helper()
+	dir := t.TempDir()
+	out := new(output)
+	return &Supervisor{
+		Path:        "/bin/sh",
+		Args:        []string{"-c", script},
+		Dir:         dir,
+		Output:      out,
+		StatePath:   filepath.Join(dir, "state.json"),
+		PIDPath:     filepath.Join(dir, "supervisor.pid"),
+		MinBackoff:  10 * time.Millisecond,
+		MaxBackoff:  40 * time.Millisecond,
+		CrashWindow: time.Minute,
+		MaxCrashes:  DefaultMaxCrashes,
+		StopTimeout: time.Second,
+	}, out
+}
+
+// start runs the supervisor until the returned func cancels it, which
+// returns the result of Run.
+func start(s *Supervisor) func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+// waitState polls the persisted state until cond holds.
+func waitState(t *testing.T, s *Supervisor, cond func(State) bool) State {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st, err := ReadState(s.StatePath)
+		if err == nil && cond(st) {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %+v, %v; condition not met", st, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// grandchild returns the process ID recorded by the child in file "pid".
+func grandchild(t *testing.T, s *Supervisor) int {
+	t.Helper()
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, err := os.ReadFile(filepath.Join(s.Dir, "pid"))
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+			return pid
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("child did not record the pid of its own child")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// exited reports whether the process pid has exited, even if it has not
+// been reaped by its new parent (e.g., in a container without an init).
+func exited(pid int) bool {
+	out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	return err != nil || strings.HasPrefix(strings.TrimSpace(string(out)), "Z")
+}
+
+func TestRunCleanExit(t *testing.T) {
+	s, out := stub(t, "echo done")
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	st, err := ReadState(s.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Phase != Stopped || st.Restarts != 0 || st.LastExit == nil || *st.LastExit != 0 {
+		t.Errorf("state = %+v, want stopped after exit code 0 without restarts", st)
+	}
+	if got := out.String(); !strings.Contains(got, "done\n") || !strings.Contains(got, "not restarting") {
+		t.Errorf("output = %q", got)
+	}
+	if _, err = os.Stat(s.PIDPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("pidfile not removed: %v", err)
+	}
+}
+
+func TestRunRestartClean(t *testing.T) {
+	// Exit cleanly twice, then keep running.
+	s, _ := stub(t, `echo run >> runs; [ "$(wc -l < runs)" -ge 3 ] && exec sleep 30; exit 0`)
+	s.RestartClean = true
+	stop := start(s)
+	st := waitState(t, s, func(st State) bool { return st.Phase == Running && st.Restarts == 2 })
+	if st.LastExit == nil || *st.LastExit != 0 {
+		t.Errorf("state = %+v, want last exit code 0", st)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+}
+
+func TestRunBackoff(t *testing.T) {
+	s, out := stub(t, "exit 3")
+	begin := time.Now()
+	err := s.Run(context.Background())
+	if !errors.Is(err, status.ErrCrashLoop) {
+		t.Fatalf("Run() = %v, want %v", err, status.ErrCrashLoop)
+	}
+	// The delay doubles after each crash, up to MaxBackoff.
+	var delays []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		_, delay, ok := strings.Cut(line, "(code 3); restarting in ")
+		if !ok {
+			t.Fatalf("unexpected output %q", line)
+		}
+		delays = append(delays, delay)
+	}
+	if got, want := strings.Join(delays, " "), "10ms 20ms 40ms 40ms"; got != want {
+		t.Errorf("backoff = %s, want %s", got, want)
+	}
+	if elapsed := time.Since(begin); elapsed < 110*time.Millisecond {
+		t.Errorf("Run() returned after %v, before the backoff elapsed", elapsed)
+	}
+	st, err := ReadState(s.StatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Phase != CrashLoop || st.Restarts != DefaultMaxCrashes-1 || st.LastExit == nil || *st.LastExit != 3 {
+		t.Errorf("state = %+v, want crash loop after %d restarts", st, DefaultMaxCrashes-1)
+	}
+}
+
+func TestRunStableResetsBackoff(t *testing.T) {
+	// Each child outlives the crash window, so it never counts as a loop and
+	// its restart is never delayed beyond MinBackoff.
+	s, out := stub(t, "sleep 0.1; exit 1")
+	s.CrashWindow = 50 * time.Millisecond
+	s.MaxCrashes = 2
+	stop := start(s)
+	waitState(t, s, func(st State) bool { return st.Restarts >= 3 })
+	if err := stop(); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if got := out.String(); strings.Contains(got, "restarting in 20ms") {
+		t.Errorf("backoff was not reset:\n%s", got)
+	}
+}
+
+func TestRunStopsProcessGroup(t *testing.T) {
+	s, _ := stub(t, "sleep 30 & echo $! > pid; wait")
+	stop := start(s)
+	waitState(t, s, func(st State) bool { return st.Phase == Running })
+	pid := grandchild(t, s)
+	if err := stop(); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if st, _ := ReadState(s.StatePath); st.Phase != Stopped || st.ChildPID != 0 {
+		t.Errorf("state = %+v, want stopped", st)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !exited(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !exited(pid) {
+		t.Errorf("process %d of the child's group is still running", pid)
+	}
+}
+
+func TestRunStopEscalates(t *testing.T) {
+	// Both the child and its own child ignore SIGTERM.
+	s, _ := stub(t, "trap '' TERM; sleep 30 & echo $! > pid; wait")
+	s.StopTimeout = 100 * time.Millisecond
+	stop := start(s)
+	waitState(t, s, func(st State) bool { return st.Phase == Running })
+	pid := grandchild(t, s)
+	begin := time.Now()
+	if err := stop(); err != nil {
+		t.Fatalf("Run() = %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed < s.StopTimeout {
+		t.Errorf("Run() returned after %v, before StopTimeout", elapsed)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !exited(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !exited(pid) {
+		t.Errorf("process %d of the child's group survived SIGKILL", pid)
+	}
+}
+
+func TestWritePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "supervisor.pid")
+	if err := os.WriteFile(path, []byte("1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePIDFile(path); !errors.Is(err, status.ErrAlreadyRunning) {
+		t.Errorf("writePIDFile(running) = %v, want %v", err, status.ErrAlreadyRunning)
+	}
+	if err := os.WriteFile(path, []byte("0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePIDFile(path); err != nil {
+		t.Fatalf("writePIDFile(stale) = %v", err)
+	}
+	if pid, err := ReadPIDFile(path); err != nil || pid != os.Getpid() {
+		t.Errorf("ReadPIDFile() = %d, %v; want %d", pid, err, os.Getpid())
+	}
+	removePIDFile(path)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("pidfile not removed: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// State is the supervisor's state, persisted as JSON for other processes.
+type State struct {
+	PID       int       `json:"pid"`       // supervisor process
+	ChildPID  int       `json:"child_pid"` // supervised process (and its group)
+	Phase     Phase     `json:"phase"`
+	Command   []string  `json:"command"`
+	Restarts  int       `json:"restarts"`
+	Started   time.Time `json:"started"`             // start of the current child
+	LastExit  *int      `json:"last_exit,omitempty"` // exit code of the previous child
+	LastError string    `json:"last_error,omitempty"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Alive reports whether the supervisor that wrote the state is still running.
+func (s State) Alive() bool {
+	return s.PID > 0 && s.Phase != Stopped && processAlive(s.PID)
+}
+
+// ChildAlive reports whether the supervised process is still running,
+// e.g., after its supervisor was killed.
+func (s State) ChildAlive() bool {
+	return s.ChildPID > 0 && processAlive(s.ChildPID)
+}
+
+// ReadState returns the state persisted at path.
+func ReadState(path string) (State, error) {
+	var s State
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("%w: %q: %w", status.ErrReadFile, path, err)
+	}
+	if err = json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("%w: %q: %w", status.ErrInvalidJSON, path, err)
+	}
+	return s, nil
+}
+
+// Active returns the state at path if its supervisor is still running.
+func Active(path string) (State, bool) {
+	s, err := ReadState(path)
+	if err != nil || !s.Alive() {
+		return s, false
+	}
+	return s, true
+}
+
+func writeState(path string, s State) error {
+	s.Updated = time.Now()
+	return config.WriteAtomic(path, 0o644, func(w io.Writer) error { //nolint:gomnd,mnd
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	})
+}
+
+// ReadPIDFile returns the process ID recorded in the pidfile at path.
+func ReadPIDFile(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q: %w", status.ErrReadFile, path, err)
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// writePIDFile records the current process in the pidfile at path,
+// failing if it names another process that is still running.
+func writePIDFile(path string) error {
+	if pid, err := ReadPIDFile(path); err == nil && pid != os.Getpid() && processAlive(pid) {
+		return fmt.Errorf("%w: pid %d (%s)", status.ErrAlreadyRunning, pid, path)
+	}
+	return config.WriteAtomic(path, 0o644, func(w io.Writer) error { //nolint:gomnd,mnd
+		_, err := fmt.Fprintln(w, os.Getpid())
+		return err
+	})
+}
+
+func removePIDFile(path string) {
+	if pid, err := ReadPIDFile(path); err == nil && pid == os.Getpid() {
+		if rerr := os.Remove(path); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "warning: remove pidfile: %v\n", rerr)
+		}
+	}
+}
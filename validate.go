@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/appium"
+	"github.com/ardnew/appium-agent/command"
+	"github.com/ardnew/appium-agent/status"
+)
+
+type validateOpts struct {
+	schema string
+}
+
+func (o *validateOpts) flags(a *agent, fset *flag.FlagSet) {
+	addScriptFlags(a, fset)
+	fset.StringVar(&o.schema, "schema", "",
+		"Validate against the JSON schema at `path` instead of the bundled schema")
+}
+
+// load returns the schema selected by the --schema flag.
+func (o *validateOpts) load() (*appium.Schema, error) {
+	if o.schema == "" {
+		return appium.DefaultSchema()
+	}
+	return appium.LoadSchema(o.schema)
+}
+
+func (o *validateOpts) run(a *agent, args []string) error {
+	sch, err := o.load()
+	if err != nil {
+		return fmt.Errorf("load Appium schema: %w", err)
+	}
+	path := command.AppiumdConfigJSON(a.cmd.Root())
+	if len(args) > 0 {
+		path = args[0]
+	}
+	doc, err := appium.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read Appium config.json: %w", err)
+	}
+	vs := sch.Validate(doc)
+	for _, v := range vs {
+		fmt.Printf("%s: %s\n", path, v)
+	}
+	if len(vs) > 0 {
+		return fmt.Errorf("%w: %d violation(s)", status.ErrSchemaViolation, len(vs))
+	}
+	if a.verbose {
+		fmt.Printf("%s: ok\n", path)
+	}
+	return nil
+}
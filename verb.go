@@ -0,0 +1,454 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/command"
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/device"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// verb is a node in the subcommand tree.
+//
+// A verb with a nil run func only groups its subcommands,
+// and it prints its usage when invoked without one.
+type verb struct {
+	name  string
+	brief string
+	args  string // positional argument syntax shown in usage
+	flags func(*agent, *flag.FlagSet)
+	run   func(*agent, []string) error
+	sub   []*verb
+}
+
+// agent holds the state shared by all verbs of a single invocation.
+type agent struct {
+	bin  string
+	cfg  *config.Model
+	cmd  *command.Model
+	fset *flag.FlagSet
+
+	devices device.Source // device lists used to validate target-device
+
+	caps    []string // capabilities (name=value) merged into appium_caps
+	files   []string // configuration files applied before the environment
+	profile string   // configuration profile applied after files
+
+	verbose   bool
+	dryRun    bool
+	output    string // format of the configuration printed by dryRun or "config show"
+	format    string // syntax of the environment printed with output "env"
+	overwrite bool
+	installed bool
+
+	wait     time.Duration // wait for Appium to become ready after starting
+	autoPort bool          // replace ports in use with free ones
+}
+
+func newAgent() *agent {
+	bin, err := os.Executable()
+	if err != nil {
+		bin = os.Args[0]
+	}
+	a := &agent{
+		bin: filepath.Base(bin),
+		cfg: new(config.Model),
+		cmd: new(command.Model),
+	}
+	// Errors are deferred until a verb actually needs the Appium init script,
+	// so that verbs like "status" and "stop" still work without it.
+	_ = a.cmd.Init()
+	return a
+}
+
+func (a *agent) init() error {
+	if err := a.cfg.Init(a.cmd); err != nil {
+		return fmt.Errorf("initialize Appium configuration: %w", err)
+	}
+	return nil
+}
+
+func (v *verb) lookup(name string) *verb {
+	for _, s := range v.sub {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// find descends the subcommand tree along the leading arguments
+// and returns the selected verb, its full name, and the remaining arguments.
+func (v *verb) find(args []string) (*verb, string, []string) {
+	curr, path := v, v.name
+	for len(args) > 0 {
+		next := curr.lookup(args[0])
+		if next == nil {
+			break
+		}
+		curr, path, args = next, path+" "+next.name, args[1:]
+	}
+	return curr, path, args
+}
+
+func (a *agent) exec(root *verb, args []string) error {
+	v, path, args := root.find(args)
+
+	a.fset = flag.NewFlagSet(path, flag.ContinueOnError)
+	addControlFlags(a, a.fset)
+	if v.flags != nil {
+		v.flags(a, a.fset)
+	}
+	a.fset.Usage = a.usage(v, path)
+
+	if err := a.fset.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		return fmt.Errorf("parse command line flags: %w", err)
+	}
+	if v.run == nil {
+		if a.fset.NArg() > 0 {
+			return fmt.Errorf("%w: %s %s", status.ErrCommandUndef, path, a.fset.Arg(0))
+		}
+		a.fset.Usage()
+		return fmt.Errorf("%w: %s requires a subcommand", status.ErrCommandUndef, path)
+	}
+	return v.run(a, a.fset.Args())
+}
+
+func (a *agent) usage(v *verb, path string) func() {
+	synopsis := path
+	if len(v.sub) > 0 {
+		synopsis += " [command]"
+	}
+	synopsis += " [flags]"
+	if v.args != "" {
+		synopsis += " " + v.args
+	}
+	cmds := make([]config.Command, 0, len(v.sub))
+	for _, s := range v.sub {
+		cmds = append(cmds, config.Command{Name: s.name, Brief: s.brief})
+	}
+	// Flags that are not Appium configuration parameters
+	// are listed first under their own heading.
+	return func() {
+		opVar := []*config.Var{}
+		a.fset.VisitAll(func(f *flag.Flag) {
+			if _, ok := f.Value.(*config.Var); ok || f.Hidden {
+				return
+			}
+			typ := config.ParseType(f.Value.Type())
+			val := f.Value.String()
+			opVar = append(opVar, config.NewVar(f.Name, f.Shorthand, "", typ, val, f.Usage))
+		})
+		env := config.Env(config.Filter(slices.Values(a.cfg.Env), func(v *config.Var) bool {
+			return a.fset.Lookup(v.Flag) != nil
+		}))
+		env.Usage(a.bin, Version, synopsis, cmds, opVar...)()
+	}
+}
+
+// command returns the shell command used to run the Appium init script.
+func (a *agent) command() (*exec.Cmd, error) {
+	if err := a.cmd.Init(); err != nil {
+		return nil, fmt.Errorf("initialize Appium launch command: %w", err)
+	}
+	sh, arg := a.cmd.Command()
+	return exec.Command(sh, arg...), nil
+}
+
+func addControlFlags(a *agent, fset *flag.FlagSet) {
+	fset.BoolVarP(&a.verbose, "verbose", "v", false,
+		"Increase output verbosity")
+}
+
+func addScriptFlags(a *agent, fset *flag.FlagSet) {
+	fset.StringVarP(&a.cmd.ScriptPath, "appium-init", "i", a.cmd.ScriptPath,
+		"`path` to Appium init script")
+	fset.StringVarP(&a.cmd.ShellPath, "appium-init-shell", "e", a.cmd.ShellPath,
+		"`path` of shell to run Appium init script")
+}
+
+// addConfigFlags adds the flags that select the Appium configuration,
+// including one flag for each variable in the configuration environment.
+func addConfigFlags(a *agent, fset *flag.FlagSet) {
+	addScriptFlags(a, fset)
+	fset.BoolVarP(&a.cfg.Debug, "debug-config", "g", false,
+		"Use the target debug configuration by default")
+	fset.BoolVarP(&a.cfg.Orphan, "orphan", "j", false,
+		"Do not inherit configuration parameters from current environment\n"+
+			"(combine with -z to use command-line flags only)")
+	fset.BoolVarP(&a.cfg.Zero, "zero", "z", false,
+		"Do not initialize default configuration parameters\n"+
+			"(use command-line flags or environment variables only)")
+	fset.StringArrayVar(&a.files, "config-file", nil,
+		"Load configuration parameters from config.env file at `path`\n"+
+			"(may be repeated; later files take precedence)")
+	fset.StringVarP(&a.profile, "profile", "P", "",
+		"Load configuration parameters from the profile named `name`\n"+
+			"(see: config profile)")
+	fset.BoolVar(&a.cfg.AllowExec, "allow-exec", false,
+		"Allow command substitutions $( … ) in any configuration parameter, which\n"+
+			"run whenever the configuration is sourced (by default, only in the\n"+
+			"default sdk-version)")
+	fset.StringArrayVar(&a.caps, "cap", nil,
+		"Set the Appium capability `name=value` in appium:options, where value\n"+
+			"is a JSON boolean, number, array or object, or else a string\n"+
+			"(may be repeated; merged into --capabilities)")
+	// Device lists are normally read from xcrun; these flags substitute
+	// captured output (e.g., to test on hosts without Xcode).
+	addDeviceFlags(a, fset)
+	_ = fset.MarkHidden("devicectl-json")
+	_ = fset.MarkHidden("simctl-json")
+	for i := range a.cfg.Env {
+		f := fset.VarPF(
+			a.cfg.Env[i],
+			a.cfg.Env[i].Flag,
+			a.cfg.Env[i].PFlag,
+			strings.Join(a.cfg.Env[i].Comment, " "),
+		)
+		if a.cfg.Env[i].IsBoolFlag() {
+			f.NoOptDefVal = "true"
+		}
+	}
+}
+
+func addPortFlags(a *agent, fset *flag.FlagSet) {
+	fset.BoolVar(&a.autoPort, "auto-port", false,
+		"Replace --listen-port or --wda-port with a free port if it is in use")
+}
+
+func addShowFlags(a *agent, fset *flag.FlagSet) {
+	addConfigFlags(a, fset)
+	fset.BoolVarP(&a.installed, "installed", "I", false,
+		"Start from the installed configuration ("+config.SourceIdent+")")
+	addOutputFlags(a, fset)
+}
+
+func addOutputFlags(a *agent, fset *flag.FlagSet) {
+	fset.StringVar(&a.output, "output", config.OutputEnv,
+		"Print the configuration in `format` "+config.OutputEnv+" (config.env) or "+
+			config.OutputJSON+"\n(a versioned schema including the launch command)")
+	fset.StringVar(&a.format, "format", config.FormatPOSIX.String(),
+		"Print the environment of --output="+config.OutputEnv+" in `syntax` "+
+			strings.Join(config.Formats, ", ")+"\n(command substitutions are expanded unless posix or fish)")
+}
+
+func addLaunchFlags(a *agent, fset *flag.FlagSet) {
+	addConfigFlags(a, fset)
+	fset.BoolVarP(&a.cmd.ForceRestart, "kill-with-fire", "f", a.cmd.ForceRestart,
+		"Kill all running Appium services before starting")
+	fset.BoolVarP(&a.cmd.SkipBuild, "restart-appium", "r", a.cmd.SkipBuild,
+		"Restart Appium without building the target app or test driver")
+	fset.BoolVarP(&a.overwrite, "overwrite-config", "w", false,
+		"Write Appium configuration to file")
+	fset.BoolVarP(&a.dryRun, "dryrun", "y", false,
+		"Print configuration and launch command")
+	addOutputFlags(a, fset)
+	addPortFlags(a, fset)
+	fset.DurationVar(&a.wait, "wait", 0,
+		"Wait up to `timeout` for Appium to report ready at its /status endpoint")
+}
+
+// verbs returns the subcommand tree rooted at the program itself.
+//
+// The root verb is an alias of "start" for compatibility with invocations
+// that predate subcommands.
+func verbs(bin string) *verb {
+	logs := new(logsOpts)
+	generate := new(generateOpts)
+	validate := new(validateOpts)
+	diff := new(diffOpts)
+	profile := new(profileOpts)
+	daemon := new(daemonOpts)
+	watch := new(watchOpts)
+	start := &verb{
+		name:  "start",
+		brief: "Install configuration (if modified) and start Appium",
+		flags: addLaunchFlags,
+		run:   runStart,
+	}
+	return &verb{
+		name:  bin,
+		flags: start.flags,
+		run:   start.run,
+		sub: []*verb{
+			start,
+			{
+				name:  "stop",
+				brief: "Stop all running Appium services",
+				flags: addScriptFlags,
+				run:   runStop,
+			},
+			{
+				name:  "restart",
+				brief: "Stop all running Appium services and start Appium",
+				flags: addLaunchFlags,
+				run:   runRestart,
+			},
+			{
+				name:  "status",
+				brief: "Report whether Appium is running",
+				flags: addScriptFlags,
+				run:   runStatus,
+			},
+			{
+				name:  "daemon",
+				brief: "Run and supervise Appium in the foreground",
+				flags: daemon.flags,
+				run:   daemon.run,
+			},
+			{
+				name:  "config",
+				brief: "Show or modify the Appium configuration",
+				sub: []*verb{
+					{
+						name:  "show",
+						brief: "Print the resolved configuration and launch command",
+						flags: addShowFlags,
+						run:   runConfigShow,
+					},
+					{
+						name:  "explain",
+						brief: "Print where each configuration parameter was defined",
+						args:  "[flag]",
+						flags: addShowFlags,
+						run:   runConfigExplain,
+					},
+					{
+						name:  "set",
+						brief: "Install configuration with the given flags applied",
+						flags: addConfigFlags,
+						run:   runConfigSet,
+					},
+					{
+						name:  "install",
+						brief: "Install the resolved configuration",
+						flags: addConfigFlags,
+						run:   runConfigInstall,
+					},
+					{
+						name:  "diff",
+						brief: "Compare configurations by parameter",
+						args:  "[from] [to]",
+						flags: diff.flags,
+						run:   diff.run,
+					},
+					{
+						name:  "profile",
+						brief: "Manage named configuration profiles",
+						sub: []*verb{
+							{
+								name:  "save",
+								brief: "Save the given configuration parameters as a profile",
+								args:  "name",
+								flags: profile.flags,
+								run:   profile.save,
+							},
+							{
+								name:  "list",
+								brief: "List all profiles",
+								run:   profile.list,
+							},
+							{
+								name:  "delete",
+								brief: "Delete a profile",
+								args:  "name",
+								run:   profile.delete,
+							},
+						},
+					},
+					{
+						name:  "history",
+						brief: "List backups of the installed configuration",
+						run:   runConfigHistory,
+					},
+					{
+						name:  "rollback",
+						brief: "Restore a backup (default: most recent) of the configuration",
+						args:  "[id]",
+						run:   runConfigRollback,
+					},
+					{
+						name:  "generate",
+						brief: "Merge the resolved configuration into Appium's config.json",
+						flags: generate.flags,
+						run:   generate.run,
+					},
+					{
+						name:  "validate",
+						brief: "Validate Appium's config.json against its JSON schema",
+						args:  "[path]",
+						flags: validate.flags,
+						run:   validate.run,
+					},
+				},
+			},
+			{
+				name:  "logs",
+				brief: "Print the Appium session or driver log",
+				args:  "[session|driver]",
+				flags: logs.flags,
+				run:   logs.run,
+				sub: []*verb{
+					{
+						name:  "rotate",
+						brief: "Move logs into the backup directory and prune old backups",
+						args:  "[session|driver …]",
+						flags: logs.rotateFlags,
+						run:   logs.rotate,
+					},
+					{
+						name:  "append",
+						brief: "Copy standard input to a log and standard output, rotating the log by size",
+						args:  "[session|driver]",
+						flags: logs.appendFlags,
+						run:   logs.append,
+					},
+				},
+			},
+			{
+				name:  "address",
+				brief: "Print the IP address selected by listen-network",
+				flags: addConfigFlags,
+				run:   runAddress,
+			},
+			{
+				name:  "devices",
+				brief: "List connected devices and available simulators",
+				flags: addDeviceFlags,
+				run:   runDevices,
+			},
+			{
+				name:  "build",
+				brief: "Build and run the test driver (WebDriverAgent) with xcodebuild",
+				flags: addBuildFlags,
+				run:   runBuild,
+			},
+			{
+				name:  "watch",
+				brief: "Run a command until its output matches a pattern",
+				args:  "-- command [arg …]",
+				flags: watch.flags,
+				run:   watch.run,
+			},
+			{
+				name:  "doctor",
+				brief: "Check the environment for common problems",
+				flags: addConfigFlags,
+				run:   runDoctor,
+			},
+		},
+	}
+}
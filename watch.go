@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/ardnew/appium-agent/status"
+	"github.com/ardnew/appium-agent/watch"
+)
+
+// watchLogLines is the number of output lines printed when a watch fails.
+const watchLogLines = 20
+
+type watchOpts struct {
+	output  string
+	pattern string
+	print   string
+	timeout time.Duration
+}
+
+func (o *watchOpts) flags(_ *agent, fset *flag.FlagSet) {
+	fset.StringVarP(&o.output, "output", "o", "",
+		"Append output of the command to file at `path` (required)")
+	fset.StringVarP(&o.pattern, "pattern", "m", "",
+		"Wait for a line of output matching regular expression `regexp` (required)")
+	fset.StringVar(&o.print, "print", "",
+		"Print only the text matched by the capture group named `name`")
+	fset.DurationVar(&o.timeout, "timeout", watch.DefaultTimeout,
+		"Kill the command if no line matches within `duration`")
+}
+
+// run starts the command, waits for its output to match the pattern, and
+// prints what was matched: the named capture group selected with --print,
+// else each named capture group as name=value, else the entire match.
+// The command continues running after a match.
+func (o *watchOpts) run(a *agent, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: watch requires a command", status.ErrCommandUndef)
+	}
+	if o.output == "" || o.pattern == "" {
+		return fmt.Errorf("%w: watch requires --output and --pattern", status.ErrInvalidValue)
+	}
+	re, err := regexp.Compile(o.pattern)
+	if err != nil {
+		return fmt.Errorf("%w: --pattern: %w", status.ErrInvalidValue, err)
+	}
+	if o.print != "" && re.SubexpIndex(o.print) < 0 {
+		return fmt.Errorf("%w: --print: no capture group named %q", status.ErrInvalidValue, o.print)
+	}
+	w := &watch.Watcher{
+		Path:    args[0],
+		Args:    args[1:],
+		Env:     os.Environ(),
+		Output:  o.output,
+		Pattern: re,
+		Timeout: o.timeout,
+	}
+	if a.verbose {
+		fmt.Fprintf(os.Stderr, "watching %s for %s\n", o.output, re)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	m, err := w.Run(ctx)
+	if err != nil {
+		if f, oerr := os.Open(o.output); oerr == nil {
+			fmt.Fprintf(os.Stderr, "==> %s <==\n", o.output)
+			_ = tail(os.Stderr, f, watchLogLines)
+			f.Close()
+		}
+		return fmt.Errorf("watch: %w", err)
+	}
+	switch names := re.SubexpNames(); {
+	case o.print != "":
+		fmt.Println(m.Groups[o.print])
+	case len(m.Groups) > 0:
+		for _, name := range names {
+			if name != "" {
+				fmt.Printf("%s=%s\n", name, m.Groups[name])
+			}
+		}
+	default:
+		fmt.Println(m.Text)
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+package watch
+
+import "time"
+
+const (
+	DefaultTimeout = 10 * time.Minute
+	PollInterval   = 100 * time.Millisecond
+)
@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Watcher runs a command with its output appended to a file and waits for a
+// line of that output to match a pattern.
+//
+// The command continues running after the pattern is matched, writing
+// directly to the file, so it does not depend on the watcher staying alive.
+type Watcher struct {
+	Path    string
+	Args    []string
+	Dir     string
+	Env     []string
+	Stdin   io.Reader      // standard input of the command (nil reads from the null device)
+	Output  string         // file to which the command's output is appended
+	Pattern *regexp.Regexp // pattern matched against each line of output
+	Timeout time.Duration  // kill the command if no line matches by then
+}
+
+// Match is a line of output matched by Watcher.Pattern.
+type Match struct {
+	Line   string
+	Text   string            // text matched by the entire pattern
+	Groups map[string]string // text matched by each named capture group
+}
+
+// Run starts the command and returns the first line of its output matching
+// the pattern.
+//
+// If the command exits or the timeout elapses before then, an error wrapping
+// status.ErrWatchExited or status.ErrWatchTimeout is returned, and the command
+// is killed in the latter case. If ctx is canceled first, e.g., by a signal,
+// an error wrapping status.ErrWatchCancel and ctx.Err() is returned, and the
+// command continues running as if it had matched.
+func (w *Watcher) Run(ctx context.Context) (*Match, error) {
+	if w.Pattern == nil {
+		return nil, fmt.Errorf("%w: pattern", status.ErrInvalidValue)
+	}
+	if err := os.MkdirAll(filepath.Dir(w.Output), 0o755); err != nil { //nolint:gomnd,mnd
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrWriteFile, w.Output, err)
+	}
+	out, err := os.OpenFile(w.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gomnd,mnd
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrOpenFile, w.Output, err)
+	}
+	defer out.Close()
+	in, err := os.Open(w.Output)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrOpenFile, w.Output, err)
+	}
+	defer in.Close()
+	// Only match output from this run of the command.
+	if _, err = in.Seek(0, io.SeekEnd); err != nil {
+		return nil, fmt.Errorf("%w: %q: %w", status.ErrReadFile, w.Output, err)
+	}
+
+	cmd := exec.Command(w.Path, w.Args...)
+	cmd.Dir, cmd.Env = w.Dir, w.Env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = w.Stdin, out, out
+	setProcessGroup(cmd)
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", w.Path, err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	deadline, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tick := time.NewTicker(PollInterval)
+	defer tick.Stop()
+
+	scan := newLineReader(in)
+	for {
+		if m, rerr := w.scan(scan); m != nil || rerr != nil {
+			return m, rerr
+		}
+		select {
+		case <-deadline.Done():
+			if err = ctx.Err(); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", status.ErrWatchCancel, w.Pattern, err)
+			}
+			_ = killGroup(cmd.Process.Pid)
+			return nil, fmt.Errorf("%w: %v: %s", status.ErrWatchTimeout, timeout, w.Pattern)
+		case xerr := <-exited:
+			// Match any output written before the command exited.
+			if m, rerr := w.scan(scan); m != nil || rerr != nil {
+				return m, rerr
+			}
+			if xerr == nil {
+				xerr = errors.New("exit status 0")
+			}
+			return nil, fmt.Errorf("%w: %s: %w", status.ErrWatchExited, w.Path, xerr)
+		case <-tick.C:
+		}
+	}
+}
+
+// scan returns the first complete line available from r that matches the
+// pattern, or nil if there are no more complete lines.
+func (w *Watcher) scan(r *lineReader) (*Match, error) {
+	for {
+		line, ok, err := r.next()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", status.ErrReadFile, w.Output, err)
+		}
+		if !ok {
+			return nil, nil
+		}
+		sub := w.Pattern.FindStringSubmatch(line)
+		if sub == nil {
+			continue
+		}
+		m := &Match{Line: line, Text: sub[0], Groups: map[string]string{}}
+		for i, name := range w.Pattern.SubexpNames() {
+			if name != "" {
+				m.Groups[name] = sub[i]
+			}
+		}
+		return m, nil
+	}
+}
+
+// lineReader reads complete lines from a file that is still being written,
+// retaining any partial line until the rest of it is available.
+type lineReader struct {
+	buf     *bufio.Reader
+	partial string
+}
+
+func newLineReader(r io.Reader) *lineReader {
+	return &lineReader{buf: bufio.NewReader(r)}
+}
+
+func (r *lineReader) next() (string, bool, error) {
+	s, err := r.buf.ReadString('\n')
+	r.partial += s
+	switch {
+	case errors.Is(err, io.EOF):
+		return "", false, nil
+	case err != nil:
+		return "", false, err
+	}
+	line := r.partial[:len(r.partial)-1]
+	r.partial = ""
+	return line, true, nil
+}
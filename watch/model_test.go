@@ -0,0 +1,193 @@
+//go:build unix
+
+package watch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardnew/appium-agent/status"
+)
+
+var urlPattern = regexp.MustCompile(`ServerURLHere->(?P<url>http://[0-9.]+:[0-9]+)<-ServerURLHere`) //nolint:gochecknoglobals
+
+// watcher returns a watcher of cat(1), which appends every line written to
+// the returned pipe to the watcher's output file.
+func watcher(t *testing.T, timeout time.Duration) (*Watcher, *io.PipeWriter) {
+	t.Helper()
+	r, w := io.Pipe()
+	// Closing the pipe ends the command, if it is still running.
+	t.Cleanup(func() { w.Close() })
+	return &Watcher{
+		Path:    "cat",
+		Stdin:   r,
+		Output:  filepath.Join(t.TempDir(), "log", "driver.log"),
+		Pattern: urlPattern,
+		Timeout: timeout,
+	}, w
+}
+
+// run runs the watcher in the background.
+func run(ctx context.Context, w *Watcher) <-chan result {
+	done := make(chan result, 1)
+	go func() {
+		m, err := w.Run(ctx)
+		done <- result{m, err}
+	}()
+	return done
+}
+
+type result struct {
+	m   *Match
+	err error
+}
+
+func write(t *testing.T, w io.Writer, s string) {
+	t.Helper()
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitOutput waits until the output file of w contains s.
+func waitOutput(t *testing.T, w *Watcher, s string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := os.ReadFile(w.Output)
+		if strings.Contains(string(b), s) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("output = %q, want it to contain %q", b, s)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunMatch(t *testing.T) {
+	w, in := watcher(t, 5*time.Second)
+	// Output from an earlier run is never matched.
+	if err := os.MkdirAll(filepath.Dir(w.Output), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	earlier := "ServerURLHere->http://10.0.0.1:8100<-ServerURLHere\n"
+	if err := os.WriteFile(w.Output, []byte(earlier), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	done := run(context.Background(), w)
+	write(t, in, "Build succeeded\nServerURLHere->http://192.168.1.")
+	// A partial line is not matched until it is complete.
+	waitOutput(t, w, "http://192.168.1.")
+	select {
+	case r := <-done:
+		t.Fatalf("Run() returned before the line was complete: %+v, %v", r.m, r.err)
+	case <-time.After(3 * PollInterval):
+	}
+	write(t, in, "10:8100<-ServerURLHere\n")
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	want := "ServerURLHere->http://192.168.1.10:8100<-ServerURLHere"
+	if r.m.Line != want || r.m.Text != want || r.m.Groups["url"] != "http://192.168.1.10:8100" {
+		t.Errorf("Run() = %+v", r.m)
+	}
+	// The command continues writing its output after the match.
+	write(t, in, "still running\n")
+	waitOutput(t, w, earlier+"Build succeeded\n"+want+"\nstill running\n")
+}
+
+func TestRunTimeout(t *testing.T) {
+	w, in := watcher(t, 3*PollInterval)
+	done := run(context.Background(), w)
+	write(t, in, "Build succeeded\n")
+	r := <-done
+	if !errors.Is(r.err, status.ErrWatchTimeout) || r.m != nil {
+		t.Fatalf("Run() = %+v, %v; want %v", r.m, r.err, status.ErrWatchTimeout)
+	}
+	// The command was killed, so nothing written to it reaches the output.
+	go func() { _, _ = io.WriteString(in, "after timeout\n") }()
+	time.Sleep(3 * PollInterval)
+	if b, _ := os.ReadFile(w.Output); strings.Contains(string(b), "after timeout") {
+		t.Errorf("command still running after timeout:\n%s", b)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	w, in := watcher(t, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := run(ctx, w)
+	write(t, in, "Build succeeded\n")
+	waitOutput(t, w, "Build succeeded\n")
+	cancel()
+	r := <-done
+	if !errors.Is(r.err, status.ErrWatchCancel) || !errors.Is(r.err, context.Canceled) ||
+		errors.Is(r.err, status.ErrWatchTimeout) {
+		t.Fatalf("Run() = %+v, %v; want %v", r.m, r.err, status.ErrWatchCancel)
+	}
+	// The command is not killed when the watch is canceled.
+	write(t, in, "still running\n")
+	waitOutput(t, w, "still running\n")
+}
+
+func TestRunExited(t *testing.T) {
+	w, in := watcher(t, time.Minute)
+	done := run(context.Background(), w)
+	write(t, in, "Build failed\n")
+	in.Close()
+	if r := <-done; !errors.Is(r.err, status.ErrWatchExited) {
+		t.Fatalf("Run() = %+v, %v; want %v", r.m, r.err, status.ErrWatchExited)
+	}
+}
+
+func TestRunMatchBeforeExit(t *testing.T) {
+	// A line written just before the command exits is still matched.
+	w, in := watcher(t, time.Minute)
+	done := run(context.Background(), w)
+	write(t, in, "ServerURLHere->http://127.0.0.1:8100<-ServerURLHere\n")
+	in.Close()
+	if r := <-done; r.err != nil || r.m.Groups["url"] != "http://127.0.0.1:8100" {
+		t.Fatalf("Run() = %+v, %v", r.m, r.err)
+	}
+}
+
+func TestRunWithoutPattern(t *testing.T) {
+	w, _ := watcher(t, time.Minute)
+	w.Pattern = nil
+	if _, err := w.Run(context.Background()); !errors.Is(err, status.ErrInvalidValue) {
+		t.Errorf("Run() = %v, want %v", err, status.ErrInvalidValue)
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	r, w := io.Pipe()
+	lines := newLineReader(r)
+	go func() {
+		for _, s := range []string{"one\ntw", "o\n", "thr", "ee\nfour"} {
+			_, _ = io.WriteString(w, s)
+		}
+		w.Close()
+	}()
+	var got []string
+	for {
+		line, ok, err := lines.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break // the pipe is read until it is closed
+		}
+		got = append(got, line)
+	}
+	if strings.Join(got, "|") != "one|two|three" || lines.partial != "four" {
+		t.Errorf("lines = %q, partial %q; want one, two, three and partial four", got, lines.partial)
+	}
+}
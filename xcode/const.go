@@ -0,0 +1,8 @@
+package xcode
+
+const (
+	Xcodebuild = "xcodebuild"
+	SDKPrefix  = "iphoneos" // SDK platform prefixed to the SDK version
+
+	DeploymentTargetSetting = "IPHONEOS_DEPLOYMENT_TARGET"
+)
@@ -0,0 +1,21 @@
+package xcode
+
+// Standalone functions (non-methods) supporting type Build.
+
+import (
+	"strings"
+
+	"github.com/ardnew/appium-agent/config"
+)
+
+// Quote returns s quoted for a POSIX shell, unless it contains only
+// characters that the shell does not interpret.
+func Quote(s string) string {
+	if s != "" && strings.Trim(s, safeChars) == "" {
+		return s
+	}
+	return config.QuotePOSIX(s, '\'')
+}
+
+const safeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+	"0123456789" + "%+,-./:=@_"
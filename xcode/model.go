@@ -0,0 +1,167 @@
+package xcode
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+// Build is an invocation of xcodebuild(1) that builds and runs the test
+// driver (WebDriverAgent) on the device under test.
+type Build struct {
+	SDK              string // SDK version, without the "iphoneos" platform prefix
+	Project          string // path of the .xcodeproj (or .xcworkspace)
+	Scheme           string
+	Configuration    string
+	Destination      string // e.g., "id=00008101-…" or "name=iPhone"
+	Jobs             int
+	DeploymentTarget string // IPHONEOS_DEPLOYMENT_TARGET
+	Actions          []string
+	Settings         []string // additional build settings (KEY=value)
+
+	// The following is required when auto-provisioning is enabled to allow
+	// automatic renewal of expired profiles (and certificates).
+	AllowProvisioningUpdates            bool
+	AllowProvisioningDeviceRegistration bool
+}
+
+// NewBuild returns the test driver build defined by the given configuration.
+// Command substitutions are run only if they are allowed (see config.Model.Expand).
+func NewBuild(m *config.Model) (*Build, error) {
+	var err error
+	val := map[string]string{}
+	for _, ident := range []string{
+		"sdk_version", "proj_source", "test_scheme", "test_config",
+		"target_dest", "ios_version",
+	} {
+		if val[ident], err = m.Expand(ident); err != nil {
+			return nil, err
+		}
+	}
+	// Like the device capabilities written to config.json, a target_dest not
+	// of the form "id=UDID" is interpreted as the device's common name.
+	dest := val["target_dest"]
+	if dest != "" && !strings.Contains(dest, "=") {
+		dest = "platform=iOS,name=" + dest
+	}
+	var actions, settings []string
+	if v, ok := m.Env.Lookup("xcbuild_act"); ok {
+		actions = v.List()
+	}
+	if v, ok := m.Env.Lookup("xcbuild_set"); ok {
+		settings = v.List()
+	}
+	return &Build{
+		SDK:                                 val["sdk_version"],
+		Project:                             val["proj_source"],
+		Scheme:                              val["test_scheme"],
+		Configuration:                       val["test_config"],
+		Destination:                         dest,
+		Jobs:                                runtime.NumCPU(),
+		DeploymentTarget:                    val["ios_version"],
+		Actions:                             actions,
+		Settings:                            settings,
+		AllowProvisioningUpdates:            true,
+		AllowProvisioningDeviceRegistration: true,
+	}, nil
+}
+
+// Validate returns an error wrapping every invalid field of b.
+func (b *Build) Validate() error {
+	var errs []error
+	invalid := func(field, format string, arg ...any) {
+		errs = append(errs, fmt.Errorf("%w: %s: %s",
+			status.ErrInvalidValue, field, fmt.Sprintf(format, arg...)))
+	}
+	if err := config.DottedVersion(b.SDK); err != nil {
+		invalid("sdk", "%v, got %q", err, b.SDK)
+	}
+	switch filepath.Ext(b.Project) {
+	case ".xcodeproj", ".xcworkspace":
+	default:
+		invalid("project", "expected a path to .xcodeproj or .xcworkspace, got %q", b.Project)
+	}
+	if b.Scheme == "" {
+		invalid("scheme", "undefined")
+	}
+	if b.Configuration == "" {
+		invalid("configuration", "undefined")
+	}
+	for _, kv := range strings.Split(b.Destination, ",") {
+		if k, v, ok := strings.Cut(kv, "="); !ok || k == "" || v == "" {
+			invalid("destination", "expected key=value[,key=value …], got %q", b.Destination)
+			break
+		}
+	}
+	if b.Jobs < 1 {
+		invalid("jobs", "expected a positive number, got %d", b.Jobs)
+	}
+	if b.DeploymentTarget != "" {
+		if err := config.DottedVersion(b.DeploymentTarget); err != nil {
+			invalid("deployment target", "%v, got %q", err, b.DeploymentTarget)
+		}
+	}
+	for _, set := range b.Settings {
+		if err := config.BuildSetting(set); err != nil {
+			invalid("build setting", "%v, got %q", err, set)
+		}
+	}
+	if len(b.Actions) == 0 {
+		invalid("action", "undefined")
+	}
+	for _, act := range b.Actions {
+		if !slices.Contains(config.XcodebuildActions, act) {
+			invalid("action", "%q is not one of %s", act, strings.Join(config.XcodebuildActions, ", "))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Args returns the command-line arguments of xcodebuild(1).
+func (b *Build) Args() []string {
+	project := "-project"
+	if filepath.Ext(b.Project) == ".xcworkspace" {
+		project = "-workspace"
+	}
+	args := []string{
+		"-sdk", SDKPrefix + b.SDK,
+		project, b.Project,
+		"-scheme", b.Scheme,
+		"-configuration", b.Configuration,
+		"-destination", b.Destination,
+		"-jobs", fmt.Sprint(b.Jobs),
+	}
+	if b.AllowProvisioningUpdates {
+		args = append(args, "-allowProvisioningUpdates")
+	}
+	if b.AllowProvisioningDeviceRegistration {
+		args = append(args, "-allowProvisioningDeviceRegistration")
+	}
+	if b.DeploymentTarget != "" {
+		args = append(args, DeploymentTargetSetting+"="+b.DeploymentTarget)
+	}
+	args = append(args, b.Settings...)
+	return append(args, b.Actions...)
+}
+
+// Command returns the xcodebuild(1) command.
+func (b *Build) Command() *exec.Cmd {
+	return exec.Command(Xcodebuild, b.Args()...)
+}
+
+// String returns the xcodebuild(1) command line quoted for a POSIX shell,
+// so that it can be copied and run by hand.
+func (b *Build) String() string {
+	words := append([]string{Xcodebuild}, b.Args()...)
+	for i, w := range words {
+		words[i] = Quote(w)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,56 @@
+package xcode
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ardnew/appium-agent/config"
+	"github.com/ardnew/appium-agent/status"
+)
+
+func TestNewBuildCommandSubst(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		t.Run(fmt.Sprintf("allow-exec=%v", allow), func(t *testing.T) {
+			marker := filepath.Join(t.TempDir(), "executed")
+			m := new(config.Model)
+			if err := m.Init(nil); err != nil {
+				t.Fatal(err)
+			}
+			m.AllowExec = allow
+			sdk, _ := m.Env.Lookup("sdk_version")
+			if err := sdk.Set("17.4"); err != nil { // the default runs xcrun(1)
+				t.Fatal(err)
+			}
+			scheme, _ := m.Env.Lookup("test_scheme")
+			if err := scheme.Set("$( touch " + marker + " && echo Driver )"); err != nil {
+				t.Fatal(err)
+			}
+			scheme.UserDef = true
+			scheme.Define(config.SourceFlag, "--"+scheme.Flag)
+
+			b, err := NewBuild(m)
+			_, serr := os.Stat(marker)
+			if !allow {
+				if !errors.Is(err, status.ErrExecDenied) {
+					t.Errorf("NewBuild() = %v, want %v", err, status.ErrExecDenied)
+				}
+				if serr == nil {
+					t.Error("denied command substitution was executed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.Scheme != "Driver" {
+				t.Errorf("Scheme = %q, want %q", b.Scheme, "Driver")
+			}
+			if serr != nil {
+				t.Error("allowed command substitution was not executed")
+			}
+		})
+	}
+}